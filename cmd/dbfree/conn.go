@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"github.com/pkg/errors"
+	"github.com/wencycool/dbfree/utils"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//连接相关的命令行选项
+//密码不通过命令行指定,避免出现在ps和shell历史中,而是通过CredentialResolver从my.cnf、.mylogin.cnf、环境变量或密码文件中读取
+type connFlags struct {
+	host         string
+	port         int
+	user         string
+	loginPath    string
+	defaultsFile string
+	passwordFile string
+}
+
+func addConnFlags(fs *flag.FlagSet) *connFlags {
+	c := &connFlags{}
+	fs.StringVar(&c.host, "host", "", "主机名、IP或者unix socket路径,默认读取my.cnf的[client],都没有时为127.0.0.1")
+	fs.IntVar(&c.port, "port", 0, "端口号,默认读取my.cnf的[client],都没有时为3306")
+	fs.StringVar(&c.user, "user", "", "用户名,默认读取my.cnf的[client],都没有时为root")
+	fs.StringVar(&c.loginPath, "login-path", "", "读取mysql_config_editor生成的.mylogin.cnf中的login-path")
+	fs.StringVar(&c.defaultsFile, "defaults-file", "", "只读取指定的my.cnf,默认读取/etc/my.cnf、/etc/mysql/my.cnf和~/.my.cnf")
+	fs.StringVar(&c.passwordFile, "password-file", "", "密码文件,文件内容为密码,也可以使用环境变量DBFREE_PASSWORD_FILE或MYSQL_PWD")
+	return c
+}
+
+//解析凭据,命令行中指定的选项优先
+func (c *connFlags) resolve() (*utils.Credentials, error) {
+	r := &utils.CredentialResolver{LoginPath: c.loginPath, PasswordFile: c.passwordFile}
+	if c.defaultsFile != "" {
+		if _, err := os.Stat(c.defaultsFile); err != nil {
+			return nil, errors.Wrap(err, "defaults-file")
+		}
+		r.MycnfPathList = []string{c.defaultsFile}
+	}
+	creds, err := r.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	if c.user != "" {
+		creds.User = c.user
+	}
+	if creds.User == "" {
+		creds.User = "root"
+	}
+	//命令行指定了host时不使用my.cnf中的socket
+	if c.host != "" {
+		creds.Host, creds.Socket = c.host, ""
+	}
+	if c.port != 0 {
+		creds.Port = c.port
+	}
+	return creds, nil
+}
+
+//连接的地址,用于显示
+func credentialsAddr(creds *utils.Credentials) string {
+	if creds.Socket != "" {
+		return creds.Socket
+	}
+	host, port := creds.Host, creds.Port
+	if strings.HasPrefix(host, "/") {
+		return host
+	}
+	if host == "" || host == "localhost" {
+		host = "127.0.0.1"
+	}
+	if port == 0 {
+		port = 3306
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
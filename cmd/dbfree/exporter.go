@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/wencycool/dbfree/utils"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//可以重复指定的-target选项
+type targetFlags []string
+
+func (t *targetFlags) String() string {
+	return strings.Join(*t, ",")
+}
+
+func (t *targetFlags) Set(value string) error {
+	*t = append(*t, value)
+	return nil
+}
+
+func runExporter(args []string) error {
+	fs := flag.NewFlagSet("exporter", flag.ExitOnError)
+	conn := addConnFlags(fs)
+	listen := fs.String("listen", ":9104", "监听地址,通过/metrics提供指标")
+	timeout := fs.Duration("timeout", 10*time.Second, "每个实例的采集超时时间")
+	variables := fs.String("variables", "", "导出的参数,逗号分隔,默认导出常用的参数")
+	var targets targetFlags
+	fs.Var(&targets, "target", "被导出的实例,格式为[name=]host:port或[name=]socket路径,可以指定多次,name默认为地址;不指定时导出-host和-port对应的实例")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	//所有实例使用相同的监控账号
+	creds, err := conn.resolve()
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		targets = append(targets, credentialsAddr(creds))
+	}
+	exporterTargets := make([]utils.ExporterTarget, 0, len(targets))
+	defer func() {
+		for _, t := range exporterTargets {
+			t.Handler.Close()
+		}
+	}()
+	for _, target := range targets {
+		name, targetCreds, err := parseExporterTarget(target, creds)
+		if err != nil {
+			return err
+		}
+		d, err := targetCreds.Connect(utils.ConnOptions{MaxOpenConns: 2})
+		if err != nil {
+			return errors.Wrap(err, name)
+		}
+		exporterTargets = append(exporterTargets, utils.ExporterTarget{Instance: name, Handler: d})
+	}
+	o := utils.ExporterOptions{ScrapeTimeout: *timeout}
+	if *variables != "" {
+		for _, v := range strings.Split(*variables, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				o.Variables = append(o.Variables, v)
+			}
+		}
+	}
+	log.Printf("在%s上导出%d个实例的指标", *listen, len(exporterTargets))
+	return utils.NewExporter(exporterTargets, o).ListenAndServe(*listen)
+}
+
+//解析[name=]host:port或[name=]socket路径,返回实例名以及该实例使用的凭据
+func parseExporterTarget(target string, creds *utils.Credentials) (string, *utils.Credentials, error) {
+	name, addr := "", target
+	if i := strings.Index(target, "="); i >= 0 {
+		name, addr = target[:i], target[i+1:]
+	}
+	if addr == "" {
+		return "", nil, errors.New("非法的target:" + target)
+	}
+	c := *creds
+	if strings.HasPrefix(addr, "/") {
+		c.Host, c.Port, c.Socket = "", 0, addr
+	} else {
+		host, portStr, err := net.SplitHostPort(addr)
+		if err != nil {
+			return "", nil, errors.Wrap(err, "非法的target:"+target)
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			return "", nil, errors.New(fmt.Sprintf("非法的target:%s,端口号不合法", target))
+		}
+		c.Host, c.Port, c.Socket = host, port, ""
+	}
+	if name == "" {
+		name = addr
+	}
+	return name, &c, nil
+}
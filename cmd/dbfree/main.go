@@ -0,0 +1,42 @@
+//dbfree命令行工具
+//	dbfree top -host 127.0.0.1 -port 3306 -login-path local -interval 2s
+//	dbfree exporter -login-path monitor -target db1=10.0.0.1:3306 -target db2=10.0.0.2:3306 -listen :9104
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `usage: dbfree <command> [options]
+
+commands:
+  top       实时查看实例的QPS/TPS、线程、缓冲池命中率、复制延迟以及活跃会话
+  exporter  Prometheus exporter,通过/metrics导出多个实例的状态、参数和复制延迟
+
+使用dbfree <command> -h查看命令的选项
+密码不通过命令行指定,从my.cnf的[client]、.mylogin.cnf、环境变量DBFREE_PASSWORD/MYSQL_PWD或密码文件中读取`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "top":
+		err = runTop(os.Args[2:])
+	case "exporter":
+		err = runExporter(os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		fmt.Println(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "未知的命令:%s\n%s\n", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/wencycool/dbfree/utils"
+	"golang.org/x/term"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//按键对应的排序字段
+var topSortKeys = map[byte]string{
+	't': utils.SessionSortTime,
+	'i': utils.SessionSortId,
+	'u': utils.SessionSortUser,
+	'd': utils.SessionSortDB,
+	'c': utils.SessionSortCommand,
+}
+
+const topHelp = "q:退出 t/i/u/d/c:按时间/ID/用户/库/命令排序 r:反向排序 k:杀会话 空格:立即刷新"
+
+//top界面的状态
+type topUI struct {
+	d         *utils.DBHandler
+	addr      string
+	interval  time.Duration
+	sortBy    string
+	desc      bool
+	inputting bool   //正在输入要杀掉的会话id
+	input     string //已经输入的会话id
+	message   string //最近一次操作的结果
+	sample    *utils.TopSample
+	err       error //最近一次采样的错误
+}
+
+func runTop(args []string) error {
+	fs := flag.NewFlagSet("top", flag.ExitOnError)
+	conn := addConnFlags(fs)
+	interval := fs.Duration("interval", 2*time.Second, "刷新间隔")
+	count := fs.Int("n", 0, "非交互模式下的刷新次数,0表示不限制")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *interval <= 0 {
+		return errors.New(fmt.Sprintf("刷新间隔必须大于0:%s", *interval))
+	}
+	creds, err := conn.resolve()
+	if err != nil {
+		return err
+	}
+	d, err := creds.Connect(utils.ConnOptions{StatementTimeout: 5 * time.Second, MaxOpenConns: 2})
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	ui := &topUI{d: d, addr: credentialsAddr(creds), interval: *interval, sortBy: utils.SessionSortTime, desc: true}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return ui.runBatch(ctx, *count)
+	}
+	return ui.runInteractive(ctx)
+}
+
+//非交互模式,每次刷新输出完整的一屏,不截断
+func (ui *topUI) runBatch(ctx context.Context, count int) error {
+	monitor := utils.NewTopMonitor(ui.d)
+	ticker := time.NewTicker(ui.interval)
+	defer ticker.Stop()
+	for i := 0; count <= 0 || i < count; i++ {
+		ui.sample, ui.err = monitor.Sample(ctx)
+		fmt.Println(strings.Join(ui.render(0, 0), "\n"))
+		fmt.Println()
+		if count > 0 && i == count-1 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+type topResult struct {
+	sample *utils.TopSample
+	err    error
+}
+
+//交互模式,使用终端的备用屏幕,退出时恢复终端
+func (ui *topUI) runInteractive(ctx context.Context) error {
+	fd := int(os.Stdin.Fd())
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, oldState)
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	keys := make(chan byte)
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				cancel()
+				return
+			}
+			for _, b := range buf[:n] {
+				select {
+				case keys <- b:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	refresh := make(chan struct{}, 1)
+	results := make(chan topResult)
+	go func() {
+		monitor := utils.NewTopMonitor(ui.d)
+		ticker := time.NewTicker(ui.interval)
+		defer ticker.Stop()
+		for {
+			sample, err := monitor.Sample(ctx)
+			select {
+			case results <- topResult{sample, err}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case <-ticker.C:
+			case <-refresh:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	ui.draw()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case r := <-results:
+			ui.sample, ui.err = r.sample, r.err
+		case key := <-keys:
+			if !ui.handleKey(ctx, key, refresh) {
+				return nil
+			}
+		}
+		ui.draw()
+	}
+}
+
+//处理按键,返回false表示退出
+func (ui *topUI) handleKey(ctx context.Context, key byte, refresh chan struct{}) bool {
+	if ui.inputting {
+		switch {
+		case key >= '0' && key <= '9':
+			ui.input += string(key)
+		case key == 127 || key == 8:
+			if len(ui.input) > 0 {
+				ui.input = ui.input[:len(ui.input)-1]
+			}
+		case key == '\r' || key == '\n':
+			ui.inputting = false
+			ui.killSession(ctx)
+			requestRefresh(refresh)
+		case key == 27 || key == 3:
+			ui.inputting = false
+			ui.message = ""
+		}
+		return true
+	}
+	if sortBy, ok := topSortKeys[key]; ok {
+		ui.sortBy = sortBy
+		return true
+	}
+	switch key {
+	case 'q', 3:
+		return false
+	case 'r':
+		ui.desc = !ui.desc
+	case 'k':
+		ui.inputting, ui.input = true, ""
+	case ' ':
+		requestRefresh(refresh)
+	}
+	return true
+}
+
+func requestRefresh(refresh chan struct{}) {
+	select {
+	case refresh <- struct{}{}:
+	default:
+	}
+}
+
+func (ui *topUI) killSession(ctx context.Context) {
+	id, err := strconv.Atoi(ui.input)
+	if err != nil {
+		ui.message = "会话id不合法:" + ui.input
+		return
+	}
+	if err := ui.d.KillSessionByIdContext(ctx, id); err != nil {
+		ui.message = fmt.Sprintf("杀会话%d失败:%v", id, err)
+		return
+	}
+	ui.message = fmt.Sprintf("已杀掉会话%d", id)
+}
+
+//重绘整个屏幕,raw模式下换行需要使用\r\n
+func (ui *topUI) draw() {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width, height = 120, 40
+	}
+	fmt.Print("\x1b[H\x1b[2J" + strings.Join(ui.render(width, height), "\r\n"))
+}
+
+//生成一屏的内容,width和height为0时不截断
+func (ui *topUI) render(width, height int) []string {
+	lines := make([]string, 0, height)
+	order := "asc"
+	if ui.desc {
+		order = "desc"
+	}
+	lines = append(lines, fmt.Sprintf("dbfree top - %s  %s  refresh:%s  sort:%s %s",
+		ui.addr, time.Now().Format("2006-01-02 15:04:05"), ui.interval, ui.sortBy, order))
+	switch {
+	case ui.err != nil:
+		lines = append(lines, "采集失败:"+ui.err.Error())
+	case ui.sample == nil:
+		lines = append(lines, "采集中...")
+	default:
+		lines = append(lines, summaryLines(ui.sample)...)
+	}
+	lines = append(lines, "", fmt.Sprintf("%-10s %-16s %-21s %-16s %-12s %7s %-24s %s", "ID", "USER", "HOST", "DB", "COMMAND", "TIME", "STATE", "INFO"))
+	if ui.sample != nil {
+		sessions := append([]*utils.Session{}, ui.sample.Sessions...)
+		utils.SortSessions(sessions, ui.sortBy, ui.desc)
+		for i, s := range sessions {
+			//给底部的提示留一行
+			if height > 0 && len(lines) >= height-1 {
+				lines = append(lines[:len(lines)-1], fmt.Sprintf("... 还有%d个会话未显示", len(sessions)-i+1))
+				break
+			}
+			lines = append(lines, fmt.Sprintf("%-10d %-16s %-21s %-16s %-12s %7d %-24s %s",
+				s.Id, s.User, s.Host, s.DB, s.Command, s.Time, s.State, strings.Join(strings.Fields(s.Info), " ")))
+		}
+	}
+	if height > 0 {
+		for len(lines) < height-1 {
+			lines = append(lines, "")
+		}
+		switch {
+		case ui.inputting:
+			lines = append(lines, "要杀掉的会话id(回车确认,ESC取消):"+ui.input)
+		case ui.message != "":
+			lines = append(lines, ui.message+"  "+topHelp)
+		default:
+			lines = append(lines, topHelp)
+		}
+	}
+	if width > 0 {
+		for i, line := range lines {
+			lines[i] = truncate(line, width)
+		}
+	}
+	return lines
+}
+
+//QPS、线程、缓冲池、行操作以及复制延迟的汇总信息
+func summaryLines(sample *utils.TopSample) []string {
+	status := sample.Status
+	lines := make([]string, 0, 4)
+	threads := fmt.Sprintf("threads running:%.0f connected:%.0f", status.Value("Threads_running"), status.Value("Threads_connected"))
+	delta := sample.Delta
+	if delta == nil {
+		lines = append(lines, "QPS:-  TPS:-  "+threads, "buffer pool hit:-  rows/s read:- inserted:- updated:- deleted:-")
+	} else {
+		lines = append(lines, fmt.Sprintf("QPS:%.1f  TPS:%.1f  %s", delta.QPS, delta.TPS, threads))
+		hit := "-"
+		if ratio, ok := delta.BufferPoolHitRatio(); ok {
+			hit = fmt.Sprintf("%.2f%%", ratio*100)
+		}
+		lines = append(lines, fmt.Sprintf("buffer pool hit:%s  rows/s read:%.0f inserted:%.0f updated:%.0f deleted:%.0f", hit,
+			delta.Rates["Innodb_rows_read"], delta.Rates["Innodb_rows_inserted"], delta.Rates["Innodb_rows_updated"], delta.Rates["Innodb_rows_deleted"]))
+	}
+	switch {
+	case !sample.Replica:
+		lines = append(lines, "replication: 非从库")
+	case sample.LagErr != nil:
+		lines = append(lines, "replication: 延迟未知,"+sample.LagErr.Error())
+	default:
+		lines = append(lines, fmt.Sprintf("replication: lag %s (%s)", sample.Lag.Lag.Round(time.Millisecond), sample.Lag.Method))
+	}
+	return lines
+}
+
+//按字符截断,避免一行超出终端宽度后折行
+func truncate(line string, width int) string {
+	runes := []rune(line)
+	if len(runes) <= width {
+		return line
+	}
+	return string(runes[:width])
+}
@@ -0,0 +1,250 @@
+//gtid包提供GTID集合的解析和运算,格式与gtid_executed一致,如:
+//
+//	3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5:7,4e11fa47-71ca-11e1-9e33-c80aa9429562:1
+//
+//MySQL 8.3开始支持带tag的GTID,如uuid:1-5:tag1:1-3,此时tag之后的区间属于uuid:tag
+package gtid
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	tagPattern  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]{0,31}$`)
+)
+
+//事务号的闭区间[Start,End]
+type Interval struct {
+	Start int64
+	End   int64
+}
+
+//GTID集合,key为小写的server_uuid,带tag时为uuid:tag,value为排好序且不重叠的区间
+type Set map[string][]Interval
+
+//解析GTID集合,忽略其中的空白和换行,空字符串返回空集合
+func Parse(s string) (Set, error) {
+	set := make(Set, 0)
+	s = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, s)
+	if s == "" {
+		return set, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		fields := strings.Split(part, ":")
+		if len(fields) < 2 || !uuidPattern.MatchString(fields[0]) {
+			return nil, errors.New("非法的GTID:" + part)
+		}
+		uuid := strings.ToLower(fields[0])
+		key := uuid
+		hasInterval := false
+		for _, field := range fields[1:] {
+			if tagPattern.MatchString(field) {
+				key = uuid + ":" + strings.ToLower(field)
+				hasInterval = false
+				continue
+			}
+			interval, err := parseInterval(field)
+			if err != nil {
+				return nil, errors.Wrap(err, "非法的GTID:"+part)
+			}
+			set[key] = append(set[key], interval)
+			hasInterval = true
+		}
+		if !hasInterval {
+			return nil, errors.New("GTID缺少事务号:" + part)
+		}
+	}
+	for key := range set {
+		set[key] = normalize(set[key])
+	}
+	return set, nil
+}
+
+//同Parse,解析失败时panic,用于常量
+func MustParse(s string) Set {
+	set, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return set
+}
+
+//解析n或n-m格式的区间
+func parseInterval(s string) (Interval, error) {
+	var (
+		interval Interval
+		err      error
+	)
+	startText, endText := s, s
+	if i := strings.Index(s, "-"); i >= 0 {
+		startText, endText = s[:i], s[i+1:]
+	}
+	if interval.Start, err = strconv.ParseInt(startText, 10, 64); err != nil {
+		return interval, err
+	}
+	if interval.End, err = strconv.ParseInt(endText, 10, 64); err != nil {
+		return interval, err
+	}
+	if interval.Start < 1 || interval.End < interval.Start {
+		return interval, errors.New("非法的区间:" + s)
+	}
+	return interval, nil
+}
+
+//排序并合并重叠或相邻的区间
+func normalize(intervals []Interval) []Interval {
+	if len(intervals) == 0 {
+		return nil
+	}
+	sorted := append([]Interval{}, intervals...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+	merged := sorted[:1]
+	for _, interval := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if interval.Start <= last.End+1 {
+			if interval.End > last.End {
+				last.End = interval.End
+			}
+			continue
+		}
+		merged = append(merged, interval)
+	}
+	return merged
+}
+
+//复制一个集合
+func (s Set) Clone() Set {
+	clone := make(Set, len(s))
+	for key, intervals := range s {
+		clone[key] = append([]Interval{}, intervals...)
+	}
+	return clone
+}
+
+//集合是否为空
+func (s Set) IsEmpty() bool {
+	for _, intervals := range s {
+		if len(intervals) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+//集合中的事务数
+func (s Set) Count() int64 {
+	var count int64
+	for _, intervals := range s {
+		for _, interval := range intervals {
+			count += interval.End - interval.Start + 1
+		}
+	}
+	return count
+}
+
+//并集,不修改s和o
+func (s Set) Union(o Set) Set {
+	union := s.Clone()
+	for key, intervals := range o {
+		union[key] = normalize(append(union[key], intervals...))
+	}
+	return union
+}
+
+//差集,即属于s但不属于o的事务,不修改s和o
+func (s Set) Subtract(o Set) Set {
+	diff := make(Set, 0)
+	for key, intervals := range s {
+		remain := append([]Interval{}, intervals...)
+		for _, sub := range o[key] {
+			next := make([]Interval, 0, len(remain)+1)
+			for _, interval := range remain {
+				if sub.End < interval.Start || sub.Start > interval.End {
+					next = append(next, interval)
+					continue
+				}
+				if interval.Start < sub.Start {
+					next = append(next, Interval{interval.Start, sub.Start - 1})
+				}
+				if interval.End > sub.End {
+					next = append(next, Interval{sub.End + 1, interval.End})
+				}
+			}
+			remain = next
+		}
+		if len(remain) > 0 {
+			diff[key] = remain
+		}
+	}
+	return diff
+}
+
+//s是否包含o中的所有事务
+func (s Set) Contains(o Set) bool {
+	return o.Subtract(s).IsEmpty()
+}
+
+//两个集合是否包含相同的事务
+func (s Set) Equal(o Set) bool {
+	return s.Contains(o) && o.Contains(s)
+}
+
+//指定uuid(可以带tag)的下一个事务号,即最大事务号加1,没有该uuid的事务时为1
+func (s Set) Next(uuid string) int64 {
+	intervals := s[strings.ToLower(uuid)]
+	if len(intervals) == 0 {
+		return 1
+	}
+	return intervals[len(intervals)-1].End + 1
+}
+
+//输出成gtid_executed的格式,按uuid排序,同一个uuid的tag按字母顺序输出在无tag的区间之后
+func (s Set) String() string {
+	groups := make(map[string][]string, 0)
+	for key, intervals := range s {
+		if len(intervals) == 0 {
+			continue
+		}
+		uuid, tag := key, ""
+		if i := strings.Index(key, ":"); i >= 0 {
+			uuid, tag = key[:i], key[i+1:]
+		}
+		text := make([]string, 0, len(intervals)+1)
+		if tag != "" {
+			text = append(text, tag)
+		}
+		for _, interval := range intervals {
+			if interval.Start == interval.End {
+				text = append(text, fmt.Sprint(interval.Start))
+			} else {
+				text = append(text, fmt.Sprintf("%d-%d", interval.Start, interval.End))
+			}
+		}
+		groups[uuid] = append(groups[uuid], strings.Join(text, ":"))
+	}
+	uuids := make([]string, 0, len(groups))
+	for uuid := range groups {
+		uuids = append(uuids, uuid)
+		//无tag的区间以数字开头,排在tag之前
+		sort.Strings(groups[uuid])
+	}
+	sort.Strings(uuids)
+	parts := make([]string, 0, len(uuids))
+	for _, uuid := range uuids {
+		parts = append(parts, uuid+":"+strings.Join(groups[uuid], ":"))
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,64 @@
+package gtid
+
+import "testing"
+
+const (
+	uuid1 = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	uuid2 = "4e11fa47-71ca-11e1-9e33-c80aa9429562"
+)
+
+func TestParse(t *testing.T) {
+	cases := map[string]string{
+		"":                                   "",
+		uuid1 + ":1-5:7":                     uuid1 + ":1-5:7",
+		uuid1 + ":6:1-5:3\n," + uuid2 + ":1": uuid1 + ":1-6," + uuid2 + ":1",
+		uuid2 + ":1, " + "3E11FA47-71CA-11E1-9E33-C80AA9429562:2-3": uuid1 + ":2-3," + uuid2 + ":1",
+		uuid1 + ":1-3:tag1:1-2:Tag0:5," + uuid1 + ":4":              uuid1 + ":1-4:tag0:5:tag1:1-2",
+	}
+	for in, want := range cases {
+		set, err := Parse(in)
+		if err != nil {
+			t.Errorf("Parse(%q):%v", in, err)
+			continue
+		}
+		if got := set.String(); got != want {
+			t.Errorf("Parse(%q)=%s,want %s", in, got, want)
+		}
+	}
+	for _, bad := range []string{"abc:1", uuid1, uuid1 + ":0", uuid1 + ":5-3", uuid1 + ":x-1", uuid1 + ":tag"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%q) should fail", bad)
+		}
+	}
+}
+
+func TestSetOperations(t *testing.T) {
+	a := MustParse(uuid1 + ":1-10:20," + uuid2 + ":1-3")
+	b := MustParse(uuid1 + ":3-5:8-12")
+
+	if got := a.Union(b).String(); got != uuid1+":1-12:20,"+uuid2+":1-3" {
+		t.Errorf("Union=%s", got)
+	}
+	if got := a.Subtract(b).String(); got != uuid1+":1-2:6-7:20,"+uuid2+":1-3" {
+		t.Errorf("Subtract=%s", got)
+	}
+	if got := b.Subtract(a).String(); got != uuid1+":11-12" {
+		t.Errorf("Subtract=%s", got)
+	}
+	if a.Contains(b) || !a.Union(b).Contains(b) || !a.Contains(MustParse(uuid1+":2-4")) {
+		t.Errorf("unexpected Contains result")
+	}
+	if !a.Equal(MustParse(uuid2+":1:2:3,"+uuid1+":20:1-10")) || a.Equal(b) {
+		t.Errorf("unexpected Equal result")
+	}
+	if !MustParse("").Contains(Set{}) || !a.Subtract(a).IsEmpty() {
+		t.Errorf("empty set mismatch")
+	}
+	if a.Count() != 14 || a.Next(uuid1) != 21 || a.Next("5e11fa47-71ca-11e1-9e33-c80aa9429562") != 1 {
+		t.Errorf("unexpected Count or Next:%d,%d", a.Count(), a.Next(uuid1))
+	}
+	//运算不修改原集合
+	if a.String() != uuid1+":1-10:20,"+uuid2+":1-3" || b.String() != uuid1+":3-5:8-12" {
+		t.Errorf("operands modified:%s,%s", a, b)
+	}
+}
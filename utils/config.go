@@ -0,0 +1,296 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//跨实例比较时默认忽略的参数,这些参数在每个实例上本来就不同,文件名类的参数默认包含主机名
+var defaultConfigIgnore = []string{
+	"server_id", "server_uuid", "hostname", "report_host", "report_port",
+	"gtid_executed", "gtid_purged", "gtid_owned",
+	"pid_file", "log_error", "general_log_file", "slow_query_log_file",
+	"log_bin_basename", "log_bin_index",
+	"relay_log", "relay_log_basename", "relay_log_index", "relay_log_info_file",
+}
+
+//参数值与my.cnf中配置的值不一致
+type ConfigDrift struct {
+	Name    string
+	Runtime string //运行中的实例上的值
+	Mycnf   string //my.cnf中配置的值,只有选项名没有值时为空
+}
+
+//比较运行中的参数和my.cnf中的配置,返回不一致的参数,按参数名排序
+//读取[mysqld]、[server]和[mysqld-主版本.次版本]选项组,包含!include的文件
+//my.cnf中不对应参数的选项(如user)以及maximum-xxx被忽略,skip-xxx和disable-xxx按照xxx=OFF比较,enable-xxx按照xxx=ON比较,log_bin和relay_log与对应的*_basename比较
+//相对路径按照相对于datadir比较,mycnf通常来自MySQLInstance.Mycnf
+func (d *DBHandler) DiffConfig(mycnf string) ([]*ConfigDrift, error) {
+	return d.DiffConfigContext(context.Background(), mycnf)
+}
+
+//同DiffConfig,ctx用于超时和取消控制
+func (d *DBHandler) DiffConfigContext(ctx context.Context, mycnf string) ([]*ConfigDrift, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	version, err := d.GetVersionContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	options := make(map[string]string)
+	groups := []string{"mysqld", "server", fmt.Sprintf("mysqld-%d.%d", version[0], version[1])}
+	if err := readOptionFile(mycnf, groups, options, 0); err != nil {
+		return nil, err
+	}
+	variables, err := d.ShowGlobalVariablesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return diffMycnf(variables, options), nil
+}
+
+//比较本地实例运行中的参数和其my.cnf,d为该实例的连接
+func (inst *MySQLInstance) DiffConfig(d *DBHandler) ([]*ConfigDrift, error) {
+	if inst.Mycnf == "" {
+		return nil, errors.New(fmt.Sprintf("实例%d没有找到my.cnf文件", inst.PID))
+	}
+	return d.DiffConfig(inst.Mycnf)
+}
+
+//比较参数和my.cnf中的选项,选项名已经统一为小写和下划线
+//相对路径按照相对于datadir处理,如./x.err与/data/mysql/x.err等价
+func diffMycnf(variables, options map[string]string) []*ConfigDrift {
+	drifts := make([]*ConfigDrift, 0)
+	datadir := variables["datadir"]
+	for option, configured := range options {
+		name := strings.TrimPrefix(option, "loose_")
+		if (name == "log_bin" || name == "relay_log") && configured != "" {
+			drifts = append(drifts, diffLogBasename(variables, name, configured, datadir)...)
+			continue
+		}
+		//maximum-xxx限制的是会话可以设置的最大值,不对应参数
+		if strings.HasPrefix(name, "maximum_") {
+			continue
+		}
+		runtime, ok := variables[name]
+		//skip-log-bin、disable-log-bin等价于log_bin=OFF,enable-xxx等价于xxx=ON
+		for _, prefix := range []string{"skip_", "disable_", "enable_"} {
+			if ok || !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			if runtime, ok = variables[strings.TrimPrefix(name, prefix)]; ok {
+				name, configured = strings.TrimPrefix(name, prefix), "OFF"
+				if prefix == "enable_" {
+					configured = "ON"
+				}
+			}
+		}
+		if !ok || configValueEqual(runtime, configured) || pathValueEqual(runtime, configured, datadir) {
+			continue
+		}
+		drifts = append(drifts, &ConfigDrift{Name: name, Runtime: runtime, Mycnf: configured})
+	}
+	sort.Slice(drifts, func(i, j int) bool {
+		return drifts[i].Name < drifts[j].Name
+	})
+	return drifts
+}
+
+//my.cnf中log_bin和relay_log的值为日志文件名的前缀,扩展名被忽略,运行时log_bin为ON,完整路径在log_bin_basename和relay_log_basename中
+func diffLogBasename(variables map[string]string, name, configured, datadir string) []*ConfigDrift {
+	if name == "log_bin" {
+		if runtime, ok := variables[name]; ok && !strings.EqualFold(runtime, "ON") {
+			return []*ConfigDrift{{Name: name, Runtime: runtime, Mycnf: configured}}
+		}
+	}
+	basename, ok := variables[name+"_basename"]
+	if !ok {
+		return nil
+	}
+	if pathValueEqual(basename, strings.TrimSuffix(configured, filepath.Ext(configured)), datadir) {
+		return nil
+	}
+	return []*ConfigDrift{{Name: name + "_basename", Runtime: basename, Mycnf: configured}}
+}
+
+//判断两个路径是否等价,其中一个为绝对路径时另一个相对路径相对于datadir
+func pathValueEqual(runtime, configured, datadir string) bool {
+	if runtime == "" || configured == "" || datadir == "" || !filepath.IsAbs(runtime) && !filepath.IsAbs(configured) {
+		return false
+	}
+	resolve := func(path string) string {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(datadir, path)
+		}
+		return filepath.Clean(path)
+	}
+	return resolve(runtime) == resolve(configured)
+}
+
+//判断运行中的值与my.cnf中的值是否等价
+//处理布尔值的多种写法、1G之类的单位、浮点数精度、路径末尾的/以及sql_mode等逗号分隔的列表顺序
+func configValueEqual(runtime, configured string) bool {
+	if strings.EqualFold(runtime, configured) {
+		return true
+	}
+	switch strings.ToUpper(runtime) {
+	case "ON", "OFF":
+		return strings.EqualFold(runtime, normalizeConfigBool(configured))
+	}
+	if r, err := strconv.ParseFloat(runtime, 64); err == nil {
+		c, ok := parseConfigSize(configured)
+		return ok && r == c
+	}
+	if len(runtime) > 1 && len(configured) > 1 && strings.EqualFold(strings.TrimRight(runtime, "/"), strings.TrimRight(configured, "/")) {
+		return true
+	}
+	if strings.Contains(runtime, ",") || strings.Contains(configured, ",") {
+		return strings.EqualFold(sortedConfigList(runtime), sortedConfigList(configured))
+	}
+	return false
+}
+
+//选项只有名字没有值时表示开启
+func normalizeConfigBool(value string) string {
+	switch strings.ToUpper(value) {
+	case "", "1", "ON", "TRUE", "YES":
+		return "ON"
+	case "0", "OFF", "FALSE", "NO":
+		return "OFF"
+	}
+	return value
+}
+
+//解析带K、M、G、T、P单位的数值,单位为1024的幂
+func parseConfigSize(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	multiplier := 1.0
+	switch value[len(value)-1] {
+	case 'k', 'K':
+		multiplier = 1 << 10
+	case 'm', 'M':
+		multiplier = 1 << 20
+	case 'g', 'G':
+		multiplier = 1 << 30
+	case 't', 'T':
+		multiplier = 1 << 40
+	case 'p', 'P':
+		multiplier = 1 << 50
+	}
+	if multiplier != 1 {
+		value = value[:len(value)-1]
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+	return f * multiplier, true
+}
+
+func sortedConfigList(value string) string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, strings.ToUpper(item))
+		}
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+//某个参数在多个实例上的值不一致
+type InstanceConfigDiff struct {
+	Name   string
+	Values map[string]string //实例名到参数值,实例上不存在该参数时没有对应的key
+}
+
+//跨实例比较的选项
+type InstanceConfigOptions struct {
+	Ignore []string //额外忽略的参数
+}
+
+//比较多个实例的全局参数,返回值不一致的参数,按参数名排序
+//handlers的key为实例名,如主库和各个从库,默认忽略server_id、server_uuid、hostname以及pid_file、relay_log等默认包含主机名的参数
+func DiffInstanceConfig(handlers map[string]*DBHandler, opts ...InstanceConfigOptions) ([]*InstanceConfigDiff, error) {
+	return DiffInstanceConfigContext(context.Background(), handlers, opts...)
+}
+
+//同DiffInstanceConfig,ctx用于超时和取消控制
+func DiffInstanceConfigContext(ctx context.Context, handlers map[string]*DBHandler, opts ...InstanceConfigOptions) ([]*InstanceConfigDiff, error) {
+	if len(handlers) < 2 {
+		return nil, errors.New("至少需要两个实例才能比较")
+	}
+	var extra []string
+	if len(opts) > 0 {
+		extra = opts[0].Ignore
+	}
+	ignore := configIgnoreSet(extra)
+	variables := make(map[string]map[string]string, len(handlers))
+	for instance, d := range handlers {
+		v, err := d.ShowGlobalVariablesContext(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, instance)
+		}
+		variables[instance] = v
+	}
+	return diffInstanceVariables(variables, ignore), nil
+}
+
+//默认忽略的参数加上额外指定的参数
+func configIgnoreSet(extra []string) map[string]bool {
+	ignore := make(map[string]bool, len(defaultConfigIgnore)+len(extra))
+	for _, name := range defaultConfigIgnore {
+		ignore[name] = true
+	}
+	for _, name := range extra {
+		ignore[strings.ToLower(name)] = true
+	}
+	return ignore
+}
+
+func diffInstanceVariables(variables map[string]map[string]string, ignore map[string]bool) []*InstanceConfigDiff {
+	names := make(map[string]bool)
+	for _, v := range variables {
+		for name := range v {
+			names[name] = true
+		}
+	}
+	diffs := make([]*InstanceConfigDiff, 0)
+	for name := range names {
+		if ignore[name] {
+			continue
+		}
+		diff := &InstanceConfigDiff{Name: name, Values: make(map[string]string, len(variables))}
+		same := true
+		first := true
+		var firstValue string
+		for instance, v := range variables {
+			value, ok := v[name]
+			if !ok {
+				same = false
+				continue
+			}
+			diff.Values[instance] = value
+			if first {
+				firstValue, first = value, false
+			} else if value != firstValue {
+				same = false
+			}
+		}
+		if !same {
+			diffs = append(diffs, diff)
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Name < diffs[j].Name
+	})
+	return diffs
+}
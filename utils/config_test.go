@@ -0,0 +1,144 @@
+package utils
+
+import "testing"
+
+func TestConfigValueEqual(t *testing.T) {
+	tests := []struct {
+		runtime    string
+		configured string
+		equal      bool
+	}{
+		{"ON", "1", true},
+		{"ON", "", true},
+		{"OFF", "false", true},
+		{"OFF", "on", false},
+		{"1073741824", "1G", true},
+		{"134217728", "128m", true},
+		{"134217728", "256M", false},
+		{"10.000000", "10", true},
+		{"/data/mysql/", "/data/mysql", true},
+		{"ROW", "row", true},
+		{"STRICT_TRANS_TABLES,NO_ENGINE_SUBSTITUTION", "NO_ENGINE_SUBSTITUTION, STRICT_TRANS_TABLES", true},
+		{"STRICT_TRANS_TABLES", "NO_ENGINE_SUBSTITUTION,STRICT_TRANS_TABLES", false},
+		{"utf8mb4", "utf8", false},
+	}
+	for _, tt := range tests {
+		if got := configValueEqual(tt.runtime, tt.configured); got != tt.equal {
+			t.Errorf("configValueEqual(%q,%q)=%v,want %v", tt.runtime, tt.configured, got, tt.equal)
+		}
+	}
+}
+
+func TestDiffMycnf(t *testing.T) {
+	variables := map[string]string{
+		"innodb_buffer_pool_size":      "1073741824",
+		"max_connections":              "500",
+		"log_bin":                      "ON",
+		"rpl_semi_sync_master_enabled": "OFF",
+		"performance_schema":           "ON",
+		"general_log":                  "OFF",
+		"event_scheduler":              "ON",
+	}
+	options := map[string]string{
+		"disable_performance_schema":         "",
+		"enable_general_log":                 "",
+		"enable_event_scheduler":             "",
+		"maximum_max_connections":            "10000",
+		"innodb_buffer_pool_size":            "1G",
+		"max_connections":                    "1000",
+		"skip_log_bin":                       "",
+		"loose_rpl_semi_sync_master_enabled": "1",
+		"user":                               "mysql",
+	}
+	drifts := diffMycnf(variables, options)
+	want := []ConfigDrift{
+		{Name: "general_log", Runtime: "OFF", Mycnf: "ON"},
+		{Name: "log_bin", Runtime: "ON", Mycnf: "OFF"},
+		{Name: "max_connections", Runtime: "500", Mycnf: "1000"},
+		{Name: "performance_schema", Runtime: "ON", Mycnf: "OFF"},
+		{Name: "rpl_semi_sync_master_enabled", Runtime: "OFF", Mycnf: "1"},
+	}
+	if len(drifts) != len(want) {
+		t.Fatalf("unexpected drifts:%+v", drifts)
+	}
+	for i, d := range drifts {
+		if *d != want[i] {
+			t.Errorf("drifts[%d]=%+v,want %+v", i, *d, want[i])
+		}
+	}
+}
+
+func TestDiffMycnf_Paths(t *testing.T) {
+	variables := map[string]string{
+		"datadir":             "/data/mysql/",
+		"log_bin":             "ON",
+		"log_bin_basename":    "/data/binlog/mysql-bin",
+		"relay_log":           "relay-bin",
+		"relay_log_basename":  "/data/mysql/relay-bin",
+		"log_error":           "./db1.err",
+		"slow_query_log_file": "/data/mysql/slow.log",
+		"tmpdir":              "/tmp",
+	}
+	tests := []struct {
+		option, configured string
+		drift              *ConfigDrift
+	}{
+		{"log_bin", "/data/binlog/mysql-bin", nil},
+		{"log_bin", "/data/binlog/mysql-bin.log", nil},
+		{"log_bin", "", nil},
+		{"log_bin", "mysql-bin", &ConfigDrift{Name: "log_bin_basename", Runtime: "/data/binlog/mysql-bin", Mycnf: "mysql-bin"}},
+		{"relay_log", "relay-bin", nil},
+		{"relay_log", "./relay-bin", nil},
+		{"relay_log", "/data/relaylog/relay-bin", &ConfigDrift{Name: "relay_log_basename", Runtime: "/data/mysql/relay-bin", Mycnf: "/data/relaylog/relay-bin"}},
+		{"log_error", "/data/mysql/db1.err", nil},
+		{"log_error", "/var/log/mysqld.log", &ConfigDrift{Name: "log_error", Runtime: "./db1.err", Mycnf: "/var/log/mysqld.log"}},
+		{"slow_query_log_file", "slow.log", nil},
+		{"tmpdir", "tmp", &ConfigDrift{Name: "tmpdir", Runtime: "/tmp", Mycnf: "tmp"}},
+	}
+	for _, tt := range tests {
+		drifts := diffMycnf(variables, map[string]string{tt.option: tt.configured})
+		switch {
+		case tt.drift == nil && len(drifts) != 0:
+			t.Errorf("%s=%s:unexpected drifts:%+v", tt.option, tt.configured, drifts[0])
+		case tt.drift != nil && (len(drifts) != 1 || *drifts[0] != *tt.drift):
+			t.Errorf("%s=%s:drifts=%+v,want %+v", tt.option, tt.configured, drifts, *tt.drift)
+		}
+	}
+	//未开启binlog时log_bin的值不生效
+	drifts := diffMycnf(map[string]string{"log_bin": "OFF"}, map[string]string{"log_bin": "mysql-bin"})
+	if len(drifts) != 1 || *drifts[0] != (ConfigDrift{Name: "log_bin", Runtime: "OFF", Mycnf: "mysql-bin"}) {
+		t.Errorf("unexpected drifts:%+v", drifts)
+	}
+}
+
+func TestDiffInstanceVariables(t *testing.T) {
+	variables := map[string]map[string]string{
+		"primary":  {"server_id": "1", "sync_binlog": "1", "read_only": "OFF", "max_connections": "500"},
+		"replica1": {"server_id": "2", "sync_binlog": "1", "read_only": "ON", "max_connections": "500"},
+		"replica2": {"server_id": "3", "sync_binlog": "0", "read_only": "ON", "max_connections": "500", "rpl_semi_sync_slave_enabled": "ON"},
+	}
+	ignore := map[string]bool{"server_id": true, "read_only": true}
+	diffs := diffInstanceVariables(variables, ignore)
+	if len(diffs) != 2 || diffs[0].Name != "rpl_semi_sync_slave_enabled" || diffs[1].Name != "sync_binlog" {
+		t.Fatalf("unexpected diffs:%+v", diffs)
+	}
+	if len(diffs[0].Values) != 1 || diffs[1].Values["replica2"] != "0" || diffs[1].Values["primary"] != "1" {
+		t.Errorf("unexpected values:%+v,%+v", diffs[0].Values, diffs[1].Values)
+	}
+}
+
+func TestDiffInstanceVariables_DefaultIgnore(t *testing.T) {
+	variables := map[string]map[string]string{
+		"primary": {"pid_file": "/data/mysql/db1.pid", "log_bin_basename": "/data/mysql/db1-bin", "relay_log": "db1-relay-bin",
+			"slow_query_log_file": "/data/mysql/db1-slow.log", "report_port": "3306", "relay_log_purge": "ON"},
+		"replica": {"pid_file": "/data/mysql/db2.pid", "log_bin_basename": "/data/mysql/db2-bin", "relay_log": "db2-relay-bin",
+			"slow_query_log_file": "/data/mysql/db2-slow.log", "report_port": "3307", "relay_log_purge": "OFF"},
+	}
+	diffs := diffInstanceVariables(variables, configIgnoreSet([]string{"Relay_Log_Purge"}))
+	if len(diffs) != 0 {
+		t.Errorf("unexpected diffs:%+v", diffs[0])
+	}
+	if diffs := diffInstanceVariables(variables, configIgnoreSet(nil)); len(diffs) != 1 || diffs[0].Name != "relay_log_purge" {
+		t.Errorf("unexpected diffs:%+v", diffs)
+	}
+}
@@ -1,32 +1,162 @@
 package utils
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
 	"fmt"
 	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
-func newDBConn(host string, port int, user, password string) (*sql.DB, error) {
+//TLS证书校验方式
+const (
+	TLSVerifyFull = "verify-full" //校验证书链和主机名
+	TLSVerifyCA   = "verify-ca"   //只校验证书链,不校验主机名
+	TLSSkipVerify = "skip-verify" //不校验证书
+	TLSPreferred  = "preferred"   //服务端支持时使用TLS,不校验证书
+)
+
+//TLS连接选项
+type TLSOptions struct {
+	CAFile     string //CA证书路径,为空时使用系统CA
+	CertFile   string //客户端证书路径,服务端要求X509时需要
+	KeyFile    string //客户端私钥路径
+	ServerName string //校验证书时使用的主机名,为空时使用连接的主机名
+	VerifyMode string //校验方式,为空时为TLSVerifyFull
+}
+
+//数据库连接选项,零值字段使用默认值
+type ConnOptions struct {
+	DBName    string //默认数据库,默认为mysql
+	Charset   string //连接字符集,如utf8mb4
+	Collation string //连接排序规则,如utf8mb4_general_ci
+	TLS       *TLSOptions
+
+	ConnectTimeout time.Duration //建立连接的超时时间,0表示不超时
+	ReadTimeout    time.Duration //读超时,0表示不超时
+	WriteTimeout   time.Duration //写超时,0表示不超时
+
+	StatementTimeout time.Duration //DBHandler方法的默认超时时间,0表示不超时,可以通过ctx单独指定
+
+	MaxOpenConns    int           //最大连接数,默认为20
+	MaxIdleConns    int           //最大空闲连接数,默认为1
+	ConnMaxLifetime time.Duration //连接最长使用时间,0表示不限制
+	ConnMaxIdleTime time.Duration //连接最长空闲时间,0表示不限制
+
+	//不安全的认证方式,需要显式开启
+	AllowCleartextPasswords bool //允许明文传输密码,用于PAM、LDAP等认证插件
+	AllowOldPasswords       bool //允许4.1之前的旧密码格式
+}
+
+//连接建立后执行SET sql_mode=该表达式,在服务端原有sql_mode的基础上去掉NO_BACKSLASH_ESCAPES,
+//保证quoteLiteral生成的字符串常量中反斜杠的含义与预期一致
+const noBackslashEscapesSQLMode = "TRIM(BOTH ',' FROM REPLACE(CONCAT(',',@@SESSION.sql_mode,','),',NO_BACKSLASH_ESCAPES,',','))"
+
+//默认的连接选项
+func DefaultConnOptions() ConnOptions {
+	return ConnOptions{
+		DBName:       "mysql",
+		MaxOpenConns: 20,
+		MaxIdleConns: 1,
+	}
+}
+
+//用于生成RegisterTLSConfig时的唯一名称
+var tlsConfigSeq uint64
+
+//根据TLS选项生成tls.Config
+func (o *TLSOptions) tlsConfig(host string) (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: o.ServerName}
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+	if o.CAFile != "" {
+		pem, err := ioutil.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("无法解析CA证书:" + o.CAFile)
+		}
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	switch o.VerifyMode {
+	case "", TLSVerifyFull:
+	case TLSVerifyCA:
+		//跳过默认的校验,自行校验证书链但不校验主机名
+		cfg.InsecureSkipVerify = true
+		roots := cfg.RootCAs
+		cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			certs := make([]*x509.Certificate, 0, len(rawCerts))
+			for _, raw := range rawCerts {
+				cert, err := x509.ParseCertificate(raw)
+				if err != nil {
+					return err
+				}
+				certs = append(certs, cert)
+			}
+			if len(certs) == 0 {
+				return errors.New("服务端没有提供证书")
+			}
+			opts := x509.VerifyOptions{Roots: roots, Intermediates: x509.NewCertPool()}
+			for _, cert := range certs[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := certs[0].Verify(opts)
+			return err
+		}
+	case TLSSkipVerify:
+		cfg.InsecureSkipVerify = true
+	default:
+		return nil, errors.New("不支持的TLS校验方式:" + o.VerifyMode)
+	}
+	return cfg, nil
+}
+
+//判断host是否为unix socket地址,支持unix:/path/mysql.sock和/path/mysql.sock两种形式
+func unixSocketPath(host string) (string, bool) {
+	switch {
+	case strings.HasPrefix(host, "unix:"):
+		return host[len("unix:"):], true
+	case strings.HasPrefix(host, "/"):
+		return host, true
+	}
+	return "", false
+}
+
+//根据连接选项生成mysql驱动的配置
+//host为unix socket地址时使用本地socket连接,此时忽略port
+func newMySQLConfig(host string, port int, user, password string, opts *ConnOptions) (*mysql.Config, error) {
 	cfg := mysql.Config{
 		User:                    user,
 		Passwd:                  password,
 		Net:                     "tcp",
 		Addr:                    fmt.Sprintf("%s:%d", host, port),
-		DBName:                  "mysql",
-		Params:                  nil,
-		Collation:               "",
+		DBName:                  opts.DBName,
+		Collation:               opts.Collation,
 		Loc:                     time.Local,
 		MaxAllowedPacket:        25 << 20,
 		ServerPubKey:            "",
 		TLSConfig:               "",
-		Timeout:                 0,
-		ReadTimeout:             0,
-		WriteTimeout:            0,
+		Timeout:                 opts.ConnectTimeout,
+		ReadTimeout:             opts.ReadTimeout,
+		WriteTimeout:            opts.WriteTimeout,
 		AllowAllFiles:           false,
-		AllowCleartextPasswords: true,
+		AllowCleartextPasswords: opts.AllowCleartextPasswords,
 		AllowNativePasswords:    true,
-		AllowOldPasswords:       true,
+		AllowOldPasswords:       opts.AllowOldPasswords,
 		ClientFoundRows:         false,
 		ColumnsWithAlias:        false,
 		InterpolateParams:       false,
@@ -34,11 +164,72 @@ func newDBConn(host string, port int, user, password string) (*sql.DB, error) {
 		ParseTime:               true,
 		RejectReadOnly:          false,
 	}
-	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if socketFile, ok := unixSocketPath(host); ok {
+		cfg.Net = "unix"
+		cfg.Addr = socketFile
+	}
+	cfg.Params = map[string]string{"sql_mode": noBackslashEscapesSQLMode}
+	if opts.Charset != "" {
+		if err := checkKeyword("字符集", opts.Charset); err != nil {
+			return nil, err
+		}
+		cfg.Params["charset"] = opts.Charset
+	}
+	if opts.TLS != nil {
+		if opts.TLS.VerifyMode == TLSPreferred {
+			cfg.TLSConfig = TLSPreferred
+		} else {
+			tlsConfig, err := opts.TLS.tlsConfig(host)
+			if err != nil {
+				return nil, err
+			}
+			cfg.TLSConfig = fmt.Sprintf("dbfree-%d", atomic.AddUint64(&tlsConfigSeq, 1))
+			if err := mysql.RegisterTLSConfig(cfg.TLSConfig, tlsConfig); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &cfg, nil
+}
+
+//创建连接池,tlsName为注册的TLS配置名,没有注册时为空,关闭连接池后需要调用mysql.DeregisterTLSConfig注销
+func newDBConn(host string, port int, user, password string, opts *ConnOptions) (db *sql.DB, tlsName string, err error) {
+	cfg, err := newMySQLConfig(host, port, user, password, opts)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+	if cfg.TLSConfig != "" && cfg.TLSConfig != TLSPreferred {
+		tlsName = cfg.TLSConfig
+	}
+	db, err = sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		if tlsName != "" {
+			mysql.DeregisterTLSConfig(tlsName)
+		}
+		return nil, "", err
+	}
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxIdleConns)
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+	return db, tlsName, nil
+}
+
+//将未设置的连接选项填充为默认值
+func mergeConnOptions(opts []ConnOptions) *ConnOptions {
+	merged := DefaultConnOptions()
+	if len(opts) == 0 {
+		return &merged
+	}
+	o := opts[0]
+	if o.DBName == "" {
+		o.DBName = merged.DBName
+	}
+	if o.MaxOpenConns == 0 {
+		o.MaxOpenConns = merged.MaxOpenConns
+	}
+	if o.MaxIdleConns == 0 {
+		o.MaxIdleConns = merged.MaxIdleConns
 	}
-	db.SetMaxOpenConns(20)
-	db.SetMaxIdleConns(1)
-	return db, nil
+	return &o
 }
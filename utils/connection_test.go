@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"context"
+	"github.com/go-sql-driver/mysql"
+	"testing"
+	"time"
+)
+
+func TestMergeConnOptions(t *testing.T) {
+	o := mergeConnOptions(nil)
+	if o.DBName != "mysql" || o.MaxOpenConns != 20 || o.MaxIdleConns != 1 || o.AllowCleartextPasswords || o.AllowOldPasswords {
+		t.Errorf("unexpected default options:%+v", o)
+	}
+	o = mergeConnOptions([]ConnOptions{{DBName: "app", MaxOpenConns: 5, ReadTimeout: time.Second}})
+	if o.DBName != "app" || o.MaxOpenConns != 5 || o.MaxIdleConns != 1 || o.ReadTimeout != time.Second {
+		t.Errorf("unexpected merged options:%+v", o)
+	}
+}
+
+func TestNewMySQLConfig(t *testing.T) {
+	opts := mergeConnOptions([]ConnOptions{{
+		Charset:        "utf8mb4",
+		ConnectTimeout: 3 * time.Second,
+		TLS:            &TLSOptions{VerifyMode: TLSSkipVerify},
+	}})
+	cfg, err := newMySQLConfig("10.0.0.1", 3306, "root", "pw", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//自定义的TLS配置注册在驱动的全局表中,测试结束后注销
+	defer mysql.DeregisterTLSConfig(cfg.TLSConfig)
+	if cfg.Addr != "10.0.0.1:3306" || cfg.Net != "tcp" || cfg.Params["charset"] != "utf8mb4" || cfg.Timeout != 3*time.Second {
+		t.Errorf("unexpected config:%+v", cfg)
+	}
+	if parsed, err := mysql.ParseDSN(cfg.FormatDSN()); err != nil || parsed.Params["sql_mode"] != noBackslashEscapesSQLMode {
+		t.Errorf("sql_mode should survive dsn round trip:%v", err)
+	}
+	if cfg.TLSConfig == "" || cfg.AllowCleartextPasswords {
+		t.Errorf("unexpected tls or auth config:%+v", cfg)
+	}
+	if _, err := newMySQLConfig("10.0.0.1", 3306, "root", "pw", mergeConnOptions([]ConnOptions{{Charset: "utf8;x"}})); err == nil {
+		t.Errorf("invalid charset should fail")
+	}
+	if _, err := newMySQLConfig("10.0.0.1", 3306, "root", "pw", mergeConnOptions([]ConnOptions{{TLS: &TLSOptions{VerifyMode: "bad"}}})); err == nil {
+		t.Errorf("invalid verify mode should fail")
+	}
+	if _, err := newMySQLConfig("10.0.0.1", 3306, "root", "pw", mergeConnOptions([]ConnOptions{{TLS: &TLSOptions{CAFile: "/nonexistent/ca.pem"}}})); err == nil {
+		t.Errorf("missing ca file should fail")
+	}
+}
+
+func TestUnixSocketPath(t *testing.T) {
+	cases := []struct {
+		host   string
+		want   string
+		wantOk bool
+	}{
+		{"/tmp/mysql.sock", "/tmp/mysql.sock", true},
+		{"unix:/data/mysql/mysql.sock", "/data/mysql/mysql.sock", true},
+		{"127.0.0.1", "", false},
+		{"localhost", "", false},
+	}
+	for _, c := range cases {
+		got, ok := unixSocketPath(c.host)
+		if got != c.want || ok != c.wantOk {
+			t.Errorf("unixSocketPath(%q)=%q,%v,want %q,%v", c.host, got, ok, c.want, c.wantOk)
+		}
+	}
+	cfg, err := newMySQLConfig("/tmp/mysql.sock", 0, "root", "", mergeConnOptions(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Net != "unix" || cfg.Addr != "/tmp/mysql.sock" {
+		t.Errorf("unexpected socket config:net=%s,addr=%s", cfg.Net, cfg.Addr)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	d := new(DBHandler)
+	ctx, cancel := d.withTimeout(context.Background())
+	if _, ok := ctx.Deadline(); ok {
+		t.Errorf("no deadline expected without statement timeout")
+	}
+	cancel()
+
+	d.SetStatementTimeout(time.Minute)
+	ctx, cancel = d.withTimeout(context.Background())
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Minute {
+		t.Errorf("statement timeout not applied:%v,%v", deadline, ok)
+	}
+	cancel()
+
+	//调用方指定的deadline优先
+	parent, parentCancel := context.WithTimeout(context.Background(), time.Hour)
+	defer parentCancel()
+	ctx, cancel = d.withTimeout(parent)
+	if deadline, _ := ctx.Deadline(); time.Until(deadline) < time.Minute {
+		t.Errorf("caller deadline should be kept:%v", deadline)
+	}
+	cancel()
+}
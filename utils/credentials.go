@@ -0,0 +1,301 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"encoding/binary"
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//连接数据库使用的凭据
+type Credentials struct {
+	User     string
+	Password string
+	Host     string
+	Port     int
+	Socket   string
+}
+
+//凭据解析器,按照以下优先级从低到高读取凭据,高优先级来源中存在的字段覆盖低优先级的:
+//	1.my.cnf文件中的选项组(默认为[client]),按MycnfPathList的顺序读取,后读取的覆盖先读取的
+//	2.mysql_config_editor生成的.mylogin.cnf中的[client]以及LoginPath选项组
+//	3.环境变量DBFREE_USER,DBFREE_PASSWORD,DBFREE_HOST,DBFREE_PORT,DBFREE_SOCKET,密码也可以使用MYSQL_PWD
+//	4.PasswordFile或环境变量DBFREE_PASSWORD_FILE指定的密码文件,文件内容为密码,忽略末尾的换行
+type CredentialResolver struct {
+	MycnfPathList []string //my.cnf文件列表,为空时使用DefaultMycnfPathList
+	Groups        []string //my.cnf中读取的选项组,为空时为client
+	LoginFile     string   //.mylogin.cnf路径,为空时使用环境变量MYSQL_TEST_LOGIN_FILE或~/.mylogin.cnf
+	LoginPath     string   //.mylogin.cnf中的选项组,即mysql --login-path指定的名称
+	PasswordFile  string   //密码文件路径
+	IgnoreEnv     bool     //不读取环境变量
+}
+
+//客户端默认读取的my.cnf文件列表,~为当前用户的home目录
+func DefaultMycnfPathList() []string {
+	list := []string{"/etc/my.cnf", "/etc/mysql/my.cnf"}
+	if u, err := user.Current(); err == nil {
+		list = append(list, expandHomeDir("~/.my.cnf", u.HomeDir))
+	}
+	return list
+}
+
+//为本地实例创建凭据解析器,使用实例的my.cnf查找路径以及当前用户的~/.my.cnf
+func (inst *MySQLInstance) CredentialResolver() *CredentialResolver {
+	list := append([]string{}, inst.MycnfPathList...)
+	if u, err := user.Current(); err == nil {
+		list = append(list, expandHomeDir("~/.my.cnf", u.HomeDir))
+	}
+	return &CredentialResolver{MycnfPathList: list}
+}
+
+//按照优先级解析凭据
+func (r *CredentialResolver) Resolve() (*Credentials, error) {
+	options := make(map[string]string, 0)
+	groups := r.Groups
+	if len(groups) == 0 {
+		groups = []string{"client"}
+	}
+	pathList := r.MycnfPathList
+	if len(pathList) == 0 {
+		pathList = DefaultMycnfPathList()
+	}
+	//1.my.cnf
+	for _, path := range pathList {
+		if finfo, err := os.Stat(path); err != nil || finfo.IsDir() {
+			continue
+		}
+		if err := readOptionFile(path, groups, options, 0); err != nil {
+			return nil, err
+		}
+	}
+	//2..mylogin.cnf
+	loginFile := r.LoginFile
+	if loginFile == "" {
+		if v, ok := os.LookupEnv("MYSQL_TEST_LOGIN_FILE"); ok && !r.IgnoreEnv {
+			loginFile = v
+		} else if u, err := user.Current(); err == nil {
+			loginFile = expandHomeDir("~/.mylogin.cnf", u.HomeDir)
+		}
+	}
+	if data, err := ioutil.ReadFile(loginFile); err == nil {
+		text, err := decodeMyLogin(data)
+		if err != nil {
+			return nil, errors.Wrap(err, "无法解析"+loginFile)
+		}
+		loginGroups := []string{"client"}
+		if r.LoginPath != "" {
+			loginGroups = append(loginGroups, r.LoginPath)
+		}
+		if err := parseOptions(text, loginGroups, filepath.Dir(loginFile), options, 0); err != nil {
+			return nil, errors.Wrap(err, "无法解析"+loginFile)
+		}
+	} else if r.LoginFile != "" || r.LoginPath != "" {
+		//显式指定了login-path时文件必须存在
+		return nil, err
+	}
+	//3.环境变量
+	passwordFile := r.PasswordFile
+	if !r.IgnoreEnv {
+		if v, ok := os.LookupEnv("MYSQL_PWD"); ok {
+			options["password"] = v
+		}
+		for _, key := range []string{"user", "password", "host", "port", "socket"} {
+			if v, ok := os.LookupEnv("DBFREE_" + strings.ToUpper(key)); ok {
+				options[key] = v
+			}
+		}
+		if v, ok := os.LookupEnv("DBFREE_PASSWORD_FILE"); ok && passwordFile == "" {
+			passwordFile = v
+		}
+	}
+	//4.密码文件
+	if passwordFile != "" {
+		data, err := ioutil.ReadFile(passwordFile)
+		if err != nil {
+			return nil, err
+		}
+		options["password"] = strings.TrimRight(string(data), "\r\n")
+	}
+	c := &Credentials{
+		User:     options["user"],
+		Password: options["password"],
+		Host:     options["host"],
+		Socket:   options["socket"],
+	}
+	if v := options["port"]; v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, errors.New("非法的端口号:" + v)
+		}
+		c.Port = port
+	}
+	return c, nil
+}
+
+//使用凭据连接数据库,指定了socket时优先使用socket,否则使用host和port,默认为127.0.0.1:3306
+func (c *Credentials) Connect(opts ...ConnOptions) (*DBHandler, error) {
+	if c.Socket != "" {
+		return NewDBHandler(c.Socket, 0, c.User, c.Password, opts...)
+	}
+	host, port := c.Host, c.Port
+	if host == "" || host == "localhost" {
+		host = "127.0.0.1"
+	}
+	if port == 0 {
+		port = 3306
+	}
+	return NewDBHandler(host, port, c.User, c.Password, opts...)
+}
+
+//读取my.cnf格式的选项文件,depth用于限制!include的嵌套层数
+func readOptionFile(path string, groups []string, options map[string]string, depth int) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := parseOptions(string(data), groups, filepath.Dir(path), options, depth); err != nil {
+		return errors.Wrap(err, path)
+	}
+	return nil
+}
+
+//解析my.cnf格式的文本,将groups中选项组的选项写入options
+//选项名中的-和_等价,统一转换成_;支持!include和!includedir
+func parseOptions(text string, groups []string, dir string, options map[string]string, depth int) error {
+	if depth > 10 {
+		return errors.New("!include嵌套层数过多")
+	}
+	inGroup := false
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+			continue
+		case strings.HasPrefix(line, "!includedir "):
+			includeDir := strings.TrimSpace(line[len("!includedir "):])
+			if !filepath.IsAbs(includeDir) {
+				includeDir = filepath.Join(dir, includeDir)
+			}
+			files, _ := filepath.Glob(filepath.Join(includeDir, "*.cnf"))
+			sort.Strings(files)
+			for _, f := range files {
+				if err := readOptionFile(f, groups, options, depth+1); err != nil {
+					return err
+				}
+			}
+		case strings.HasPrefix(line, "!include "):
+			includeFile := strings.TrimSpace(line[len("!include "):])
+			if !filepath.IsAbs(includeFile) {
+				includeFile = filepath.Join(dir, includeFile)
+			}
+			if err := readOptionFile(includeFile, groups, options, depth+1); err != nil {
+				return err
+			}
+		case line[0] == '[':
+			end := strings.Index(line, "]")
+			if end < 0 {
+				return errors.New("非法的选项组:" + line)
+			}
+			name := strings.ToLower(strings.TrimSpace(line[1:end]))
+			inGroup = false
+			for _, g := range groups {
+				if strings.ToLower(g) == name {
+					inGroup = true
+				}
+			}
+		case inGroup:
+			key, value := line, ""
+			if i := strings.Index(line, "="); i >= 0 {
+				key, value = strings.TrimSpace(line[:i]), parseOptionValue(strings.TrimSpace(line[i+1:]))
+			}
+			options[strings.Replace(strings.ToLower(key), "-", "_", -1)] = value
+		}
+	}
+	return scanner.Err()
+}
+
+//解析选项值,去掉引号和行尾注释,处理引号内的转义字符
+func parseOptionValue(value string) string {
+	if value == "" {
+		return value
+	}
+	if quote := value[0]; quote == '"' || quote == '\'' {
+		var b strings.Builder
+		for i := 1; i < len(value); i++ {
+			c := value[i]
+			switch {
+			case c == '\\' && i+1 < len(value):
+				i++
+				switch value[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				case 's':
+					b.WriteByte(' ')
+				default:
+					b.WriteByte(value[i])
+				}
+			case c == quote:
+				return b.String()
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return b.String()
+	}
+	if i := strings.Index(value, "#"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value
+}
+
+//解密mysql_config_editor生成的.mylogin.cnf文件
+//文件格式:4字节保留位,20字节密钥,之后每一行为4字节小端长度加上AES-128-ECB加密的内容
+func decodeMyLogin(data []byte) (string, error) {
+	const headerLen = 4 + 20
+	if len(data) < headerLen {
+		return "", errors.New(fmt.Sprintf("文件长度%d小于%d", len(data), headerLen))
+	}
+	var key [aes.BlockSize]byte
+	for i, b := range data[4:headerLen] {
+		key[i%aes.BlockSize] ^= b
+	}
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	data = data[headerLen:]
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return "", errors.New("文件内容被截断")
+		}
+		n := int(binary.LittleEndian.Uint32(data[:4]))
+		data = data[4:]
+		if n == 0 || n%aes.BlockSize != 0 || n > len(data) {
+			return "", errors.New(fmt.Sprintf("非法的加密块长度:%d", n))
+		}
+		chunk := make([]byte, n)
+		for i := 0; i < n; i += aes.BlockSize {
+			block.Decrypt(chunk[i:i+aes.BlockSize], data[i:i+aes.BlockSize])
+		}
+		pad := int(chunk[n-1])
+		if pad == 0 || pad > aes.BlockSize {
+			return "", errors.New("非法的填充长度")
+		}
+		out.Write(chunk[:n-pad])
+		data = data[n:]
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+//按照mysql_config_editor的格式加密,用于测试
+func encodeMyLogin(text string) []byte {
+	rawKey := []byte("0123456789abcdefghij")
+	var key [aes.BlockSize]byte
+	for i, b := range rawKey {
+		key[i%aes.BlockSize] ^= b
+	}
+	block, _ := aes.NewCipher(key[:])
+	var out bytes.Buffer
+	out.Write(make([]byte, 4))
+	out.Write(rawKey)
+	for _, line := range bytes.SplitAfter([]byte(text), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		pad := aes.BlockSize - len(line)%aes.BlockSize
+		plain := append(append([]byte{}, line...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+		cipher := make([]byte, len(plain))
+		for i := 0; i < len(plain); i += aes.BlockSize {
+			block.Encrypt(cipher[i:i+aes.BlockSize], plain[i:i+aes.BlockSize])
+		}
+		var n [4]byte
+		binary.LittleEndian.PutUint32(n[:], uint32(len(cipher)))
+		out.Write(n[:])
+		out.Write(cipher)
+	}
+	return out.Bytes()
+}
+
+func TestDecodeMyLogin(t *testing.T) {
+	text := "[client]\nuser = \"root\"\npassword = \"p#ss\"\n[backup]\nuser = \"bak\"\nhost = \"10.0.0.5\"\n"
+	got, err := decodeMyLogin(encodeMyLogin(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != text {
+		t.Errorf("decodeMyLogin()=%q,want %q", got, text)
+	}
+	if _, err := decodeMyLogin([]byte("short")); err == nil {
+		t.Errorf("short file should fail")
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	text := `
+# comment
+[mysqld]
+user = mysql
+[client]
+user = app
+password = 'p w'
+port = 3307 # inline comment
+socket = /tmp/mysql.sock
+skip-ssl
+[mysql]
+user = other
+`
+	options := make(map[string]string)
+	if err := parseOptions(text, []string{"client"}, "", options, 0); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"user": "app", "password": "p w", "port": "3307", "socket": "/tmp/mysql.sock", "skip_ssl": ""}
+	for k, v := range want {
+		if options[k] != v {
+			t.Errorf("options[%s]=%q,want %q", k, options[k], v)
+		}
+	}
+	if len(options) != len(want) {
+		t.Errorf("unexpected options:%v", options)
+	}
+}
+
+func TestParseOptionValue(t *testing.T) {
+	cases := map[string]string{
+		`abc`:          "abc",
+		`abc # x`:      "abc",
+		`"a#b"`:        "a#b",
+		`'a b'`:        "a b",
+		`"a\"b"`:       `a"b`,
+		`"line\nnext"`: "line\nnext",
+		``:             "",
+	}
+	for in, want := range cases {
+		if got := parseOptionValue(in); got != want {
+			t.Errorf("parseOptionValue(%q)=%q,want %q", in, got, want)
+		}
+	}
+}
+
+func TestCredentialResolver_Resolve(t *testing.T) {
+	dir := t.TempDir()
+	mycnf := filepath.Join(dir, "my.cnf")
+	extra := filepath.Join(dir, "extra.cnf")
+	loginFile := filepath.Join(dir, ".mylogin.cnf")
+	passwordFile := filepath.Join(dir, "password")
+	writeFile := func(path string, data []byte) {
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(mycnf, []byte("[client]\nuser=cnf_user\npassword=cnf_pw\nhost=10.0.0.1\n!include extra.cnf\n"))
+	writeFile(extra, []byte("[client]\nport=3307\n"))
+	writeFile(loginFile, encodeMyLogin("[client]\nuser = \"login_user\"\n[backup]\npassword = \"login_pw\"\n"))
+	writeFile(passwordFile, []byte("file_pw\n"))
+
+	t.Setenv("DBFREE_HOST", "env_host")
+	r := &CredentialResolver{MycnfPathList: []string{mycnf, filepath.Join(dir, "missing.cnf")}, LoginFile: loginFile, IgnoreEnv: true}
+	c, err := r.Resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.User != "login_user" || c.Password != "cnf_pw" || c.Host != "10.0.0.1" || c.Port != 3307 {
+		t.Errorf("unexpected credentials from my.cnf and login file:%+v", c)
+	}
+
+	r.LoginPath = "backup"
+	if c, err = r.Resolve(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Password != "login_pw" {
+		t.Errorf("login path password should override my.cnf:%+v", c)
+	}
+
+	r.IgnoreEnv = false
+	t.Setenv("DBFREE_USER", "env_user")
+	t.Setenv("MYSQL_PWD", "env_pw")
+	if c, err = r.Resolve(); err != nil {
+		t.Fatal(err)
+	}
+	if c.User != "env_user" || c.Password != "env_pw" || c.Host != "env_host" {
+		t.Errorf("environment should override option files:%+v", c)
+	}
+
+	r.PasswordFile = passwordFile
+	if c, err = r.Resolve(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Password != "file_pw" {
+		t.Errorf("password file should override environment:%+v", c)
+	}
+}
@@ -0,0 +1,206 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+//数据库信息
+type DatabaseInfo struct {
+	Name       string
+	Charset    string //默认字符集
+	Collation  string //默认排序规则
+	TableCount int    //表的数量,不包括视图
+	DataSize   int64  //数据大小(字节)
+	IndexSize  int64  //索引大小(字节)
+}
+
+//系统库,任何情况下都不允许删除
+var systemSchemas = map[string]bool{
+	"mysql":              true,
+	"information_schema": true,
+	"performance_schema": true,
+	"sys":                true,
+}
+
+//是否为系统库
+func isSystemSchema(dbname string) bool {
+	return systemSchemas[strings.ToLower(dbname)]
+}
+
+//查看所有数据库以及字符集、表数量和大小
+func (d *DBHandler) ListDatabases() ([]*DatabaseInfo, error) {
+	return d.ListDatabasesContext(context.Background())
+}
+
+//同ListDatabases,ctx用于超时和取消控制
+func (d *DBHandler) ListDatabasesContext(ctx context.Context) ([]*DatabaseInfo, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	listDatabasesSQL := "SELECT s.SCHEMA_NAME,s.DEFAULT_CHARACTER_SET_NAME,s.DEFAULT_COLLATION_NAME," +
+		"COUNT(t.TABLE_NAME),IFNULL(SUM(t.DATA_LENGTH),0),IFNULL(SUM(t.INDEX_LENGTH),0) " +
+		"FROM information_schema.SCHEMATA s LEFT JOIN information_schema.TABLES t " +
+		"ON t.TABLE_SCHEMA=s.SCHEMA_NAME AND t.TABLE_TYPE='BASE TABLE' " +
+		"GROUP BY s.SCHEMA_NAME,s.DEFAULT_CHARACTER_SET_NAME,s.DEFAULT_COLLATION_NAME ORDER BY s.SCHEMA_NAME"
+	rows, err := d.conn.QueryContext(ctx, listDatabasesSQL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	databases := make([]*DatabaseInfo, 0)
+	for rows.Next() {
+		db := new(DatabaseInfo)
+		if err := rows.Scan(&db.Name, &db.Charset, &db.Collation, &db.TableCount, &db.DataSize, &db.IndexSize); err != nil {
+			return nil, err
+		}
+		databases = append(databases, db)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return databases, nil
+}
+
+//新增一个数据库,数据库已经存在时不报错
+//charset和collate为空时使用服务端的默认值,不为空时会校验是否为服务端支持的字符集和排序规则
+func (d *DBHandler) CreateDB(dbname, charset, collate string) error {
+	return d.CreateDBContext(context.Background(), dbname, charset, collate)
+}
+
+//同CreateDB,ctx用于超时和取消控制
+func (d *DBHandler) CreateDBContext(ctx context.Context, dbname, charset, collate string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	if dbname == "" {
+		return errors.New("数据库名不能为空")
+	}
+	if err := d.checkCharsetCollation(ctx, charset, collate); err != nil {
+		return err
+	}
+	createDBSQL := fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", quoteIdentifier(dbname))
+	if charset != "" {
+		createDBSQL += " CHARACTER SET = " + charset
+	}
+	if collate != "" {
+		createDBSQL += " COLLATE = " + collate
+	}
+	_, err := d.conn.ExecContext(ctx, createDBSQL)
+	return err
+}
+
+//校验字符集和排序规则是否被服务端支持,以及排序规则是否属于该字符集
+func (d *DBHandler) checkCharsetCollation(ctx context.Context, charset, collate string) error {
+	if charset != "" {
+		if err := checkKeyword("字符集", charset); err != nil {
+			return err
+		}
+		charsets, err := d.queryFirstColumns(ctx, "SHOW CHARACTER SET", 1)
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, c := range charsets {
+			if strings.EqualFold(c[0], charset) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New(fmt.Sprintf("数据库不支持字符集:%s", charset))
+		}
+	}
+	if collate != "" {
+		if err := checkKeyword("排序规则", collate); err != nil {
+			return err
+		}
+		//SHOW COLLATION的前两列为Collation和Charset
+		collations, err := d.queryFirstColumns(ctx, "SHOW COLLATION", 2)
+		if err != nil {
+			return err
+		}
+		var collateCharset string
+		for _, c := range collations {
+			if strings.EqualFold(c[0], collate) {
+				collateCharset = c[1]
+				break
+			}
+		}
+		if collateCharset == "" {
+			return errors.New(fmt.Sprintf("数据库不支持排序规则:%s", collate))
+		}
+		if charset != "" && !strings.EqualFold(collateCharset, charset) {
+			return errors.New(fmt.Sprintf("排序规则%s不属于字符集%s", collate, charset))
+		}
+	}
+	return nil
+}
+
+//执行查询并返回每一行的前n列,用于列数随版本变化的SHOW语句
+func (d *DBHandler) queryFirstColumns(ctx context.Context, query string, n int) ([][]string, error) {
+	rows, err := d.conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	colNames, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if len(colNames) < n {
+		return nil, errors.New(fmt.Sprintf("%s返回的列数%d小于%d", query, len(colNames), n))
+	}
+	var (
+		result       = make([][]string, 0)
+		colValues    = make([]sql.RawBytes, len(colNames))
+		colValuesPtr = make([]interface{}, len(colNames))
+	)
+	for i := range colValues {
+		colValuesPtr[i] = &colValues[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(colValuesPtr...); err != nil {
+			return nil, err
+		}
+		row := make([]string, n)
+		for i := 0; i < n; i++ {
+			row[i] = string(colValues[i])
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+//删除一个数据库
+//系统库不允许删除;库中还有表、视图或存储过程时需要force为true才会删除
+func (d *DBHandler) DropDB(dbname string, force bool) error {
+	return d.DropDBContext(context.Background(), dbname, force)
+}
+
+//同DropDB,ctx用于超时和取消控制
+func (d *DBHandler) DropDBContext(ctx context.Context, dbname string, force bool) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	if isSystemSchema(dbname) {
+		return errors.New(fmt.Sprintf("不允许删除系统库:%s", dbname))
+	}
+	if !force {
+		var objectCount int
+		row := d.conn.QueryRowContext(ctx, "SELECT (SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA=?)"+
+			"+(SELECT COUNT(*) FROM information_schema.ROUTINES WHERE ROUTINE_SCHEMA=?)", dbname, dbname)
+		if err := row.Scan(&objectCount); err != nil {
+			return err
+		}
+		if objectCount > 0 {
+			return errors.New(fmt.Sprintf("数据库%s中还有%d个对象,需要强制删除", dbname, objectCount))
+		}
+	}
+	dropDBSQL := fmt.Sprintf("DROP DATABASE %s", quoteIdentifier(dbname))
+	_, err := d.conn.ExecContext(ctx, dropDBSQL)
+	return err
+}
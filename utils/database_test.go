@@ -0,0 +1,29 @@
+package utils
+
+import "testing"
+
+func TestIsSystemSchema(t *testing.T) {
+	for name, want := range map[string]bool{
+		"mysql":              true,
+		"MySQL":              true,
+		"information_schema": true,
+		"performance_schema": true,
+		"sys":                true,
+		"mysql_app":          false,
+		"sales":              false,
+	} {
+		if got := isSystemSchema(name); got != want {
+			t.Errorf("isSystemSchema(%q)=%v,want %v", name, got, want)
+		}
+	}
+}
+
+func TestDropDB_SystemSchema(t *testing.T) {
+	//系统库在访问数据库之前就会被拒绝
+	d := new(DBHandler)
+	for _, name := range []string{"mysql", "SYS"} {
+		if err := d.DropDB(name, true); err == nil {
+			t.Errorf("DropDB(%q) should be refused", name)
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package utils
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"github.com/go-sql-driver/mysql"
 	"github.com/pkg/errors"
 	"regexp"
 	"strconv"
@@ -11,23 +13,67 @@ import (
 )
 
 type DBHandler struct {
-	conn *sql.DB
+	conn    *sql.DB
+	timeout time.Duration //默认的语句超时时间,0表示不超时
+	tlsName string        //连接注册的TLS配置名,Close时注销
 }
 
-func NewDBHandler(host string, port int, user, password string) (*DBHandler, error) {
+//创建数据库连接,opts为可选的连接选项,不指定时使用DefaultConnOptions
+//host可以是unix socket地址,如/tmp/mysql.sock或unix:/tmp/mysql.sock,此时忽略port
+func NewDBHandler(host string, port int, user, password string, opts ...ConnOptions) (*DBHandler, error) {
 	self := new(DBHandler)
-	db, err := newDBConn(host, port, user, password)
+	o := mergeConnOptions(opts)
+	db, tlsName, err := newDBConn(host, port, user, password, o)
 	if err != nil {
 		return nil, err
 	}
 	self.conn = db
+	self.tlsName = tlsName
+	self.timeout = o.StatementTimeout
 	return self, nil
 }
 
+//设置默认的语句超时时间,0表示不超时
+//不带Context的方法以及ctx没有设置deadline的XxxContext方法都使用该超时时间
+func (d *DBHandler) SetStatementTimeout(timeout time.Duration) {
+	d.timeout = timeout
+}
+
+//关闭数据库连接池,并注销连接使用的TLS配置
+func (d *DBHandler) Close() error {
+	err := d.conn.Close()
+	if d.tlsName != "" {
+		mysql.DeregisterTLSConfig(d.tlsName)
+	}
+	return err
+}
+
+//检查连接是否可用,使用默认的语句超时时间
+func (d *DBHandler) ping() error {
+	ctx, cancel := d.withTimeout(context.Background())
+	defer cancel()
+	return d.conn.PingContext(ctx)
+}
+
+//ctx没有设置deadline时使用默认的语句超时时间
+func (d *DBHandler) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || d.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d.timeout)
+}
+
 //查看数据库版本
 func (d *DBHandler) GetVersion() ([3]int, error) {
+	return d.GetVersionContext(context.Background())
+}
+
+//同GetVersion,ctx用于超时和取消控制
+func (d *DBHandler) GetVersionContext(ctx context.Context) ([3]int, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
 	var versionText string
-	row := d.conn.QueryRow("select version()")
+	row := d.conn.QueryRowContext(ctx, "select version()")
 	if err := row.Scan(&versionText); err != nil {
 		return [3]int{0, 0, 0}, err
 	}
@@ -43,70 +89,39 @@ func (d *DBHandler) GetVersion() ([3]int, error) {
 	return [3]int{fisrtV, secondV, thirdV}, nil
 }
 
-//新增一个数据库
-func (d *DBHandler) CreateDB(dbname, charset, collate string) error {
-	createDBSQL := fmt.Sprintf("CREATE DATABASE %s CHARACTER SET = %s COLLATE = %s", dbname, charset, collate)
-	_, err := d.conn.Exec(createDBSQL)
-	return err
-}
-
-//删除一个数据库
-func (d *DBHandler) DropDB(dbname string) error {
-	dropDBSQL := fmt.Sprintf("DROP DATABASE %s", dbname)
-	_, err := d.conn.Exec(dropDBSQL)
-	return err
+//判断数据库版本是否大于等于指定版本
+func versionAtLeast(version, min [3]int) bool {
+	for i := 0; i < 3; i++ {
+		if version[i] != min[i] {
+			return version[i] > min[i]
+		}
+	}
+	return true
 }
 
 //根据用户名和主机拼接成mysql的用户形式
 func userName(user, host string) string {
 	if host == "" {
-		return fmt.Sprintf("'%s'", user)
+		return quoteLiteral(user)
 	} else {
-		return fmt.Sprintf("'%s'@'%s'", user, host)
+		return quoteLiteral(user) + "@" + quoteLiteral(host)
 	}
 
 }
 
-//创建一个用户
-func (d *DBHandler) CreateUser(user, host, password, plugin string) error {
-	username := userName(user, host)
-	var createUserSQL string
-	switch plugin {
-	case "":
-		createUserSQL = fmt.Sprintf("CREATE USER %s IDENTIFIED BY '%s'", username, plugin)
-	case "mysql_native_password":
-		createUserSQL = fmt.Sprintf("CREATE USER %s IDENTIFIED WITH %s BY '%s'", username, plugin, password)
-	}
-	_, err := d.conn.Exec(createUserSQL)
-	return err
-}
-
 //删除一个用户
 func (d *DBHandler) DropUser(user, host string) error {
-	username := userName(user, host)
-	var dropUserSQL string
-	dropUserSQL = fmt.Sprintf("DROP USER %s", username)
-	_, err := d.conn.Exec(dropUserSQL)
-	return err
+	return d.DropUserContext(context.Background(), user, host)
 }
 
-//修改一个用户的密码
-func (d *DBHandler) AlterUser(user, host, password string) error {
+//同DropUser,ctx用于超时和取消控制
+func (d *DBHandler) DropUserContext(ctx context.Context, user, host string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
 	username := userName(user, host)
-	var alterUserSQL string
-	var plugin string
-	//查找当前用户的plugin选项
-	row := d.conn.QueryRow(fmt.Sprintf("SELECT PLUGIN FROM MYSQL.USER WHERE USER HOST='%s' AND USER='%s'", host, user))
-	if err := row.Scan(&plugin); err != nil {
-		return err
-	}
-	switch plugin {
-	case "":
-		alterUserSQL = fmt.Sprintf("CREATE USER %s IDENTIFIED BY '%s'", username, plugin)
-	case "mysql_native_password":
-		alterUserSQL = fmt.Sprintf("CREATE USER %s IDENTIFIED WITH %s BY '%s'", username, plugin, password)
-	}
-	_, err := d.conn.Exec(alterUserSQL)
+	var dropUserSQL string
+	dropUserSQL = fmt.Sprintf("DROP USER %s", username)
+	_, err := d.conn.ExecContext(ctx, dropUserSQL)
 	return err
 }
 
@@ -115,17 +130,60 @@ func (d *DBHandler) AlterUser(user, host, password string) error {
 //objectType:TABLE,FUNCTION,PROCEDURE
 //privLevel:*,*.*,db_name.*,db_name.tbl_name,tbl_name,db_name.routine_name
 func (d *DBHandler) GrantUser(user, host string, privs []string, objectType, privLevel string, grantOption bool) error {
-	username := userName(user, host)
-	var grantUserSQL string
+	return d.GrantUserContext(context.Background(), user, host, privs, objectType, privLevel, grantOption)
+}
+
+//同GrantUser,ctx用于超时和取消控制
+func (d *DBHandler) GrantUserContext(ctx context.Context, user, host string, privs []string, objectType, privLevel string, grantOption bool) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	privText, on, err := formatGrantTarget(privs, objectType, privLevel)
+	if err != nil {
+		return err
+	}
+	grantUserSQL := fmt.Sprintf("GRANT %s ON %s TO %s", privText, on, userName(user, host))
 	if grantOption {
-		grantUserSQL = fmt.Sprintf("GRANT %s ON %s %s TO %s", strings.Join(privs, ","), objectType, privLevel, username)
-	} else {
-		grantUserSQL = fmt.Sprintf("GRANT %s ON %s %s TO %s WITH GRANT OPTION", strings.Join(privs, ","), objectType, privLevel, username)
+		grantUserSQL += " WITH GRANT OPTION"
 	}
-	_, err := d.conn.Exec(grantUserSQL)
+	_, err = d.conn.ExecContext(ctx, grantUserSQL)
 	return err
 }
 
+//回收一个用户的权限,参数含义与GrantUser相同
+//回收WITH GRANT OPTION时privs中指定GRANT OPTION
+func (d *DBHandler) RevokeUser(user, host string, privs []string, objectType, privLevel string) error {
+	return d.RevokeUserContext(context.Background(), user, host, privs, objectType, privLevel)
+}
+
+//同RevokeUser,ctx用于超时和取消控制
+func (d *DBHandler) RevokeUserContext(ctx context.Context, user, host string, privs []string, objectType, privLevel string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	privText, on, err := formatGrantTarget(privs, objectType, privLevel)
+	if err != nil {
+		return err
+	}
+	_, err = d.conn.ExecContext(ctx, fmt.Sprintf("REVOKE %s ON %s FROM %s", privText, on, userName(user, host)))
+	return err
+}
+
+//校验并格式化GRANT/REVOKE语句中的权限列表以及ON子句
+func formatGrantTarget(privs []string, objectType, privLevel string) (privText, on string, err error) {
+	if privText, err = formatPrivileges(privs); err != nil {
+		return "", "", err
+	}
+	if objectType, err = formatObjectType(objectType); err != nil {
+		return "", "", err
+	}
+	if privLevel, err = formatPrivLevel(privLevel); err != nil {
+		return "", "", err
+	}
+	if objectType == "" {
+		return privText, privLevel, nil
+	}
+	return privText, objectType + " " + privLevel, nil
+}
+
 //复制用户
 //mysql> show create user 'test1';
 //+--------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------+
@@ -142,65 +200,115 @@ func (d *DBHandler) GrantUser(user, host string, privs []string, objectType, pri
 //| GRANT `r1`@`%`,`r2`@`%` TO `u1`@`localhost` |
 
 func (d *DBHandler) CopyUser(fromUser, fromHost, toUser, toHost string) error {
-	fromUserName := userName(fromUser, fromHost)
-	toUserName := userName(toUser, toHost)
-	var (
-		showCreatUserSQL     string
-		showCreateUserResult string
-		showGrantUserSQL     string
-		showGrantUserResult  string
-		copyOnlyUserSQL      string
-		copyOnlyPrivSQL      string
-	)
-	//因为需要用到两个SQL语句在一个事务中，因此需要开启事务
-	tx, err := d.conn.Begin()
+	return d.CopyUserContext(context.Background(), fromUser, fromHost, toUser, toHost)
+}
+
+//同CopyUser,ctx用于超时和取消控制
+func (d *DBHandler) CopyUserContext(ctx context.Context, fromUser, fromHost, toUser, toHost string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	return d.CopyUserToContext(ctx, d, fromUser, fromHost, toUser, toHost)
+}
+
+//将当前实例上的用户复制到target实例上,target可以是当前实例本身
+//会复制用户的认证信息、账号属性、所有授权、角色以及默认角色
+//CREATE USER和GRANT都会隐式提交,无法使用事务,因此任何一步失败时都会删除target上新建的用户
+func (d *DBHandler) CopyUserTo(target *DBHandler, fromUser, fromHost, toUser, toHost string) (err error) {
+	return d.CopyUserToContext(context.Background(), target, fromUser, fromHost, toUser, toHost)
+}
+
+//同CopyUserTo,ctx用于超时和取消控制
+func (d *DBHandler) CopyUserToContext(ctx context.Context, target *DBHandler, fromUser, fromHost, toUser, toHost string) (err error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	if fromHost == "" {
+		fromHost = "%"
+	}
+	if toHost == "" {
+		toHost = "%"
+	}
+	to := Account{User: toUser, Host: toHost}
+	version, err := d.GetVersionContext(ctx)
 	if err != nil {
 		return err
 	}
-	//进行copy用户
-	showCreatUserSQL = fmt.Sprintf("show create user %s", fromUserName)
-	//CREATE USER 'test1'@'%' IDENTIFIED WITH xxxx
-	row := tx.QueryRow(showCreatUserSQL)
-	if err := row.Scan(&showCreateUserResult); err != nil {
+	if !versionAtLeast(version, minUserMgmtVersion) {
+		return errors.New(fmt.Sprintf("CopyUser需要MySQL %d.%d.%d及以上版本,当前版本:%v",
+			minUserMgmtVersion[0], minUserMgmtVersion[1], minUserMgmtVersion[2], version))
+	}
+	//获取源用户的建用户语句、授权语句以及默认角色
+	showCreateUserResult, err := d.showCreateUser(ctx, fromUser, fromHost, version)
+	if err != nil {
 		return err
 	}
-	userSubMatch := regexp.MustCompile(`CREATE USER (?P<uname>\S+) IDENTIFIED WITH`).FindStringSubmatch(showCreateUserResult)
-	if len(userSubMatch) == 0 {
-		return errors.New("无法匹配用户" + showCreateUserResult)
+	copyOnlyUserSQL, err := rewriteCreateUser(showCreateUserResult, to)
+	if err != nil {
+		return err
 	}
-	copyOnlyUserSQL = strings.Replace(showCreateUserResult, userSubMatch[1], toUserName, 1)
-
-	//进行copy权限
-	showGrantUserSQL = fmt.Sprintf("show grants for %s", fromUserName)
-	row = tx.QueryRow(showGrantUserSQL)
-	if err := row.Scan(&showGrantUserResult); err != nil {
+	grantLines, err := d.showGrantLines(ctx, fromUser, fromHost)
+	if err != nil {
 		return err
 	}
-	grantSubMatch := regexp.MustCompile(`GRANT .+ ON .+ TO (?P<uname>\S+)`).FindStringSubmatch(showGrantUserResult)
-	if len(grantSubMatch) == 0 {
-		return errors.New("无法匹配权限" + showGrantUserResult)
+	copyOnlyPrivSQLs := make([]string, 0, len(grantLines))
+	for _, line := range grantLines {
+		copyOnlyPrivSQL, err := rewriteGrantee(line, to)
+		if err != nil {
+			return err
+		}
+		copyOnlyPrivSQLs = append(copyOnlyPrivSQLs, copyOnlyPrivSQL)
+	}
+	var defaultRoles []Account
+	if version[0] >= 8 {
+		if defaultRoles, err = d.defaultRoles(ctx, fromUser, fromHost); err != nil {
+			return err
+		}
 	}
-	copyOnlyPrivSQL = strings.Replace(showGrantUserResult, grantSubMatch[1], toUserName, -1)
-
 	//开始进行创建用户并且赋权
-	_, err = tx.Exec(copyOnlyUserSQL)
-	if err != nil {
+	if _, err = target.conn.ExecContext(ctx, copyOnlyUserSQL); err != nil {
 		return err
 	}
-	_, err = tx.Exec(copyOnlyPrivSQL)
-	if err != nil {
-		return err
+	defer func() {
+		if err != nil {
+			//ctx可能已经超时或被取消,回滚使用新的context
+			rollbackCtx, rollbackCancel := target.withTimeout(context.Background())
+			defer rollbackCancel()
+			if _, dropErr := target.conn.ExecContext(rollbackCtx, fmt.Sprintf("DROP USER %s", to)); dropErr != nil {
+				err = errors.Wrap(err, "回滚时删除用户失败:"+dropErr.Error())
+			}
+		}
+	}()
+	for _, copyOnlyPrivSQL := range copyOnlyPrivSQLs {
+		if _, err = target.conn.ExecContext(ctx, copyOnlyPrivSQL); err != nil {
+			return errors.Wrap(err, copyOnlyPrivSQL)
+		}
 	}
-	return tx.Commit()
+	if len(defaultRoles) > 0 {
+		roles := make([]string, 0, len(defaultRoles))
+		for _, r := range defaultRoles {
+			roles = append(roles, r.String())
+		}
+		setDefaultRoleSQL := fmt.Sprintf("SET DEFAULT ROLE %s TO %s", strings.Join(roles, ","), to)
+		if _, err = target.conn.ExecContext(ctx, setDefaultRoleSQL); err != nil {
+			return errors.Wrap(err, setDefaultRoleSQL)
+		}
+	}
+	return nil
 }
 
 //获取所有的状态信息
 func (d *DBHandler) ShowGlobalStatus() (map[string]string, error) {
+	return d.ShowGlobalStatusContext(context.Background())
+}
+
+//同ShowGlobalStatus,ctx用于超时和取消控制
+func (d *DBHandler) ShowGlobalStatusContext(ctx context.Context) (map[string]string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
 	var (
 		statusMap = make(map[string]string, 0)
 		k         string
 		v         string
-		rows, err = d.conn.Query("show global status")
+		rows, err = d.conn.QueryContext(ctx, "show global status")
 	)
 	if err != nil {
 		return nil, err
@@ -217,13 +325,34 @@ func (d *DBHandler) ShowGlobalStatus() (map[string]string, error) {
 	return statusMap, nil
 }
 
-//获取所有的参数信息
+//获取所有的参数信息,会话级别的参数为当前连接的值
 func (d *DBHandler) ShowVariables() (map[string]string, error) {
+	return d.ShowVariablesContext(context.Background())
+}
+
+//同ShowVariables,ctx用于超时和取消控制
+func (d *DBHandler) ShowVariablesContext(ctx context.Context) (map[string]string, error) {
+	return d.showVariables(ctx, "show variables")
+}
+
+//获取所有的全局参数信息
+func (d *DBHandler) ShowGlobalVariables() (map[string]string, error) {
+	return d.ShowGlobalVariablesContext(context.Background())
+}
+
+//同ShowGlobalVariables,ctx用于超时和取消控制
+func (d *DBHandler) ShowGlobalVariablesContext(ctx context.Context) (map[string]string, error) {
+	return d.showVariables(ctx, "show global variables")
+}
+
+func (d *DBHandler) showVariables(ctx context.Context, query string) (map[string]string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
 	var (
 		varMap    = make(map[string]string, 0)
 		k         string
 		v         string
-		rows, err = d.conn.Query("show variables")
+		rows, err = d.conn.QueryContext(ctx, query)
 	)
 	if err != nil {
 		return nil, err
@@ -240,129 +369,91 @@ func (d *DBHandler) ShowVariables() (map[string]string, error) {
 	return varMap, nil
 }
 
-//修改数据库参数
-func (d *DBHandler) SetVariable(varName, varValue string) error {
-	if _, err := d.conn.Exec(fmt.Sprintf("set global %s = %s", varName, varValue)); err != nil {
-		return err
-	} else {
-		return nil
-	}
+//查看主从复制状态,返回原始的列名和值,NULL值为空字符串
+//Deprecated: 使用ShowReplicaStatus获取解析后的复制状态
+func (d *DBHandler) ShowSlaveStatus() ([]map[string]string, error) {
+	return d.ShowSlaveStatusContext(context.Background())
 }
 
-//查看主从复制状态
-func (d *DBHandler) ShowSlaveStatus() ([]map[string]string, error) {
-	showSlaveStatusSQL := "show slave status"
-	rows, err := d.conn.Query(showSlaveStatusSQL)
+//同ShowSlaveStatus,ctx用于超时和取消控制
+func (d *DBHandler) ShowSlaveStatusContext(ctx context.Context) ([]map[string]string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	version, err := d.GetVersionContext(ctx)
 	if err != nil {
 		return nil, err
 	}
-	var (
-		slaveMaps    []map[string]string
-		colNames     []string
-		colValues    []interface{}
-		colValuesPtr []interface{}
-	)
-	slaveMaps = make([]map[string]string, 0)
-	if colNames, err = rows.Columns(); err != nil {
-		return nil, err
-	}
-	colValues = make([]interface{}, len(colNames))
-	colValuesPtr = make([]interface{}, len(colNames))
-	for i, _ := range colValues {
-		colValuesPtr[i] = &colValues[i]
-	}
-	if err != nil {
-		return nil, err
+	//保持SHOW SLAVE STATUS的列名,8.4已经不支持SHOW SLAVE STATUS,使用新语法后将列名转换回去
+	query := showReplicaStatusSQL(version)
+	rows, err := d.queryStringMaps(ctx, query)
+	if err != nil || query == "SHOW SLAVE STATUS" {
+		return rows, err
 	}
-	for rows.Next() {
-		if err := rows.Scan(colValuesPtr...); err != nil {
-			return nil, err
+	for i, row := range rows {
+		legacy := make(map[string]string, len(row))
+		for k, v := range row {
+			legacy[legacyReplicaColumn(k)] = v
 		}
-		slaveMap := make(map[string]string, 0)
-		for i, v := range colValues {
-			switch t := v.(type) {
-			case []byte:
-				slaveMap[colNames[i]] = string(t)
-			case time.Time:
-				slaveMap[colNames[i]] = t.String()
-			case nil:
-				slaveMap[colNames[i]] = ""
-			default:
-				return nil, errors.New("无法解析该数据类型" + fmt.Sprint(t))
-			}
-
-		}
-		slaveMaps = append(slaveMaps, slaveMap)
+		rows[i] = legacy
 	}
-	rows.Close()
-	return slaveMaps, nil
+	return rows, nil
 }
 
 //杀掉指定session id的连接
 func (d *DBHandler) KillSessionById(sessionId int) error {
-	_, err := d.conn.Exec(fmt.Sprintf("kill %d", sessionId))
+	return d.KillSessionByIdContext(context.Background(), sessionId)
+}
+
+//同KillSessionById,ctx用于超时和取消控制
+func (d *DBHandler) KillSessionByIdContext(ctx context.Context, sessionId int) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	_, err := d.conn.ExecContext(ctx, fmt.Sprintf("kill %d", sessionId))
 
 	return err
 }
 
 //杀掉某一个用户下的所有session id连接
 func (d *DBHandler) KillSessionByUser(user string) error {
-	return d.killSessionByxx("user", user, "=")
+	return d.KillSessionByUserContext(context.Background(), user)
+}
+
+//同KillSessionByUser,ctx用于超时和取消控制
+func (d *DBHandler) KillSessionByUserContext(ctx context.Context, user string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	return d.killSessionByxx(ctx, &SessionFilter{User: user})
 }
 
 //杀掉某一个客户端主机名下的所有session id连接
 func (d *DBHandler) KillSessionByClientHost(host string) error {
-	host = host + ":%"
-	return d.killSessionByxx("host", host, "like")
+	return d.KillSessionByClientHostContext(context.Background(), host)
+}
+
+//同KillSessionByClientHost,ctx用于超时和取消控制
+func (d *DBHandler) KillSessionByClientHostContext(ctx context.Context, host string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	return d.killSessionByxx(ctx, &SessionFilter{ClientHost: host})
 }
 
-//todo 杀掉所有的查询语句
+//杀掉所有的查询语句
 func (d *DBHandler) KillSessionBySelect() error {
-	return nil
+	return d.KillSessionBySelectContext(context.Background())
 }
 
-//byType=user,host,db,command,time,state,info
-//opera= like <,<=,>,>=,!=,=
-func (d *DBHandler) killSessionByxx(byType string, value interface{}, opera string) error {
-	getProcesslistSQL := fmt.Sprintf("select id,user,host,db,command,time,state,info from information_schema.processlist where %s %s ?", byType, opera)
-	p, err := d.conn.Prepare(getProcesslistSQL)
-	if err != nil {
-		return err
-	}
-	var (
-		sessionId          int
-		user               string
-		host               sql.NullString
-		db                 sql.NullString
-		command            string
-		timeSpend          string
-		state              sql.NullString
-		info               sql.NullString
-		sessionIds         []int
-		unKilledSessionIds []int
-	)
-	rows, err := p.Query(value)
+//同KillSessionBySelect,ctx用于超时和取消控制
+func (d *DBHandler) KillSessionBySelectContext(ctx context.Context) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	return d.killSessionByxx(ctx, &SessionFilter{Command: "Query", SQLPrefix: "SELECT"})
+}
+
+//杀掉满足过滤条件的所有会话,有会话未能杀掉时返回错误
+func (d *DBHandler) killSessionByxx(ctx context.Context, filter *SessionFilter) error {
+	results, err := d.KillSessionsContext(ctx, filter, false)
 	if err != nil {
 		return err
 	}
-	for rows.Next() {
-		if err := rows.Scan(&sessionId, &user, &host, &db, &command, &timeSpend, &state, &info); err != nil {
-			return err
-		}
-		sessionIds = append(sessionIds, sessionId)
-	}
-	rows.Columns()
-	p.Close()
-	//开始删除会话
-	for _, id := range sessionIds {
-		_, err := d.conn.Exec(fmt.Sprintf("kill %d", id))
-		if err != nil {
-			unKilledSessionIds = append(unKilledSessionIds, id)
-		}
-	}
-	if len(unKilledSessionIds) == 0 {
-		return nil
-	} else {
-		return errors.New(fmt.Sprintf("Need kill sessions:%v,unkilled sessions:%v", sessionIds, unKilledSessionIds))
-	}
+	return killResultsError(results)
 }
@@ -24,6 +24,23 @@ func TestDBHandler_ShowSlaveStatus(t *testing.T) {
 	}
 }
 
+func TestDBHandler_ShowReplicaStatus(t *testing.T) {
+	var (
+		dbHandler *DBHandler
+		err       error
+	)
+	if dbHandler, err = NewDBHandler("192.168.31.101", 3340, "root", "root"); err != nil {
+		panic(err)
+	}
+	if statusList, err := dbHandler.ShowReplicaStatus(); err != nil {
+		panic(err)
+	} else {
+		for _, s := range statusList {
+			fmt.Printf("channel:%s,source:%s:%d,io:%s,sql:%s,behind:%d\n", s.Channel, s.SourceHost, s.SourcePort, s.IORunning, s.SQLRunning, s.SecondsBehind)
+		}
+	}
+}
+
 func TestDBHandler_CreateUser(t *testing.T) {
 	var (
 		dbHandler *DBHandler
@@ -35,7 +52,7 @@ func TestDBHandler_CreateUser(t *testing.T) {
 	user := "test"
 	host := "%"
 	password := "test"
-	if err := dbHandler.CreateUser(user, host, password, ""); err != nil {
+	if err := dbHandler.CreateUser(&UserSpec{User: user, Host: host, Password: password}); err != nil {
 		t.Error(err)
 	} else {
 		t.Logf("创建用户:%s 成功", user)
@@ -91,3 +108,79 @@ func TestDBHandler_KillSessionByClientHost(t *testing.T) {
 		t.Log("删除成功")
 	}
 }
+
+func TestDBHandler_ListRoles(t *testing.T) {
+	var (
+		dbHandler *DBHandler
+		err       error
+	)
+	if dbHandler, err = NewDBHandler("192.168.31.101", 3340, "root", "root"); err != nil {
+		panic(err)
+	}
+	if err := dbHandler.CreateRole("app_ro", "%"); err != nil {
+		t.Fatal(err)
+	}
+	defer dbHandler.DropRole("app_ro", "%")
+	if err := dbHandler.GrantUser("app_ro", "%", []string{"SELECT"}, "", "mysql.*", false); err != nil {
+		t.Fatal(err)
+	}
+	if roles, err := dbHandler.ListRoles(); err != nil {
+		t.Error(err)
+	} else {
+		for _, r := range roles {
+			t.Logf("角色:%s,成员数:%d,权限数:%d", r.Account, len(r.Members), len(r.Privileges))
+		}
+	}
+}
+
+func TestDBHandler_DiscoverTopology(t *testing.T) {
+	var (
+		dbHandler *DBHandler
+		err       error
+	)
+	if dbHandler, err = NewDBHandler("192.168.31.101", 3340, "root", "root"); err != nil {
+		panic(err)
+	}
+	topo, err := dbHandler.DiscoverTopology(NewConnector("root", "root"))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Print(topo.Text())
+	fmt.Print(topo.DOT())
+}
+
+func TestDBHandler_ReplicationLag(t *testing.T) {
+	var (
+		dbHandler *DBHandler
+		err       error
+	)
+	if dbHandler, err = NewDBHandler("192.168.31.101", 3340, "root", "root"); err != nil {
+		panic(err)
+	}
+	if lag, err := dbHandler.ReplicationLag(); err != nil {
+		panic(err)
+	} else {
+		fmt.Printf("lag:%v,method:%s\n", lag.Lag, lag.Method)
+	}
+}
+
+func TestDBHandler_SetVariable(t *testing.T) {
+	var (
+		dbHandler *DBHandler
+		err       error
+	)
+	if dbHandler, err = NewDBHandler("192.168.31.101", 3340, "root", "root"); err != nil {
+		panic(err)
+	}
+	info, err := dbHandler.GetVariableInfo("max_connections")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("%+v\n", info)
+	if err := dbHandler.SetVariable("max_connections", info.Value); err != nil {
+		panic(err)
+	}
+	if err := dbHandler.SetVariable("innodb_page_size", "8192"); err == nil {
+		t.Errorf("static variable should not be set dynamically")
+	}
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/wencycool/dbfree/gtid"
+	"time"
+)
+
+//查看实例已经执行的GTID集合,即@@GLOBAL.gtid_executed
+func (d *DBHandler) GtidExecuted() (gtid.Set, error) {
+	return d.GtidExecutedContext(context.Background())
+}
+
+//同GtidExecuted,ctx用于超时和取消控制
+func (d *DBHandler) GtidExecutedContext(ctx context.Context) (gtid.Set, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	var gtidExecuted string
+	if err := d.conn.QueryRowContext(ctx, "SELECT @@GLOBAL.gtid_executed").Scan(&gtidExecuted); err != nil {
+		return nil, err
+	}
+	return gtid.Parse(gtidExecuted)
+}
+
+//检查当前实例(从库)上是否存在主库没有的事务,返回这些事务的GTID集合,没有时返回空集合
+//这类事务一般是直接在从库上写入的,切换后会被发送给其他从库或者因为主库已经清理binlog导致复制中断
+func (d *DBHandler) CheckErrantTransactions(source *DBHandler) (gtid.Set, error) {
+	return d.CheckErrantTransactionsContext(context.Background(), source)
+}
+
+//同CheckErrantTransactions,ctx用于超时和取消控制
+func (d *DBHandler) CheckErrantTransactionsContext(ctx context.Context, source *DBHandler) (gtid.Set, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	replicaExecuted, err := d.GtidExecutedContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sourceExecuted, err := source.GtidExecutedContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return replicaExecuted.Subtract(sourceExecuted), nil
+}
+
+//等待当前实例执行完set中的所有事务,超时返回错误,需要MySQL 5.7.5及以上版本
+//ctx没有设置deadline时使用timeout加上5秒作为语句超时时间,而不是默认的语句超时时间
+func (d *DBHandler) WaitForExecutedGtidSet(set gtid.Set, timeout time.Duration) error {
+	return d.WaitForExecutedGtidSetContext(context.Background(), set, timeout)
+}
+
+//同WaitForExecutedGtidSet,ctx用于超时和取消控制
+func (d *DBHandler) WaitForExecutedGtidSetContext(ctx context.Context, set gtid.Set, timeout time.Duration) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout+5*time.Second)
+		defer cancel()
+	}
+	var timedOut int
+	row := d.conn.QueryRowContext(ctx, "SELECT WAIT_FOR_EXECUTED_GTID_SET(?, ?)", set.String(), timeout.Seconds())
+	if err := row.Scan(&timedOut); err != nil {
+		return err
+	}
+	if timedOut != 0 {
+		return errors.New(fmt.Sprintf("等待执行GTID集合超时(%v):%s", timeout, set))
+	}
+	return nil
+}
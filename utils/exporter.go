@@ -0,0 +1,291 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//导出的指标名前缀
+const metricNamespace = "mysql"
+
+//默认导出的参数
+var defaultExporterVariables = []string{
+	"max_connections", "max_allowed_packet", "open_files_limit", "table_open_cache", "thread_cache_size",
+	"innodb_buffer_pool_size", "innodb_log_file_size", "innodb_flush_log_at_trx_commit", "sync_binlog",
+	"long_query_time", "read_only", "super_read_only",
+}
+
+//被导出的实例,Instance作为所有指标的target标签,不使用instance标签以免和Prometheus添加的instance标签冲突
+type ExporterTarget struct {
+	Instance string
+	Handler  *DBHandler
+}
+
+//exporter的选项,零值字段使用默认值
+type ExporterOptions struct {
+	ScrapeTimeout time.Duration    //每个实例的采集超时时间,默认为10秒,Prometheus通过请求头指定了更短的超时时间时以请求头为准
+	Variables     []string         //导出的参数,只导出数字和ON/OFF类型的值,默认为defaultExporterVariables
+	Heartbeat     HeartbeatOptions //计算复制延迟时使用的心跳表
+}
+
+func mergeExporterOptions(opts []ExporterOptions) *ExporterOptions {
+	o := ExporterOptions{}
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.ScrapeTimeout <= 0 {
+		o.ScrapeTimeout = 10 * time.Second
+	}
+	if len(o.Variables) == 0 {
+		o.Variables = defaultExporterVariables
+	}
+	return &o
+}
+
+//Prometheus exporter,实现了http.Handler,以文本格式输出所有实例的指标
+//每次请求时并发采集所有实例,某个实例采集失败时该实例的mysql_up为0,不影响其它实例
+type Exporter struct {
+	targets []ExporterTarget
+	o       *ExporterOptions
+}
+
+func NewExporter(targets []ExporterTarget, opts ...ExporterOptions) *Exporter {
+	return &Exporter{targets: targets, o: mergeExporterOptions(opts)}
+}
+
+//在addr上监听,通过/metrics提供指标
+func (e *Exporter) ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+	return http.ListenAndServe(addr, mux)
+}
+
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	timeout := e.o.ScrapeTimeout
+	if header := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); header != "" {
+		if seconds, err := strconv.ParseFloat(header, 64); err == nil && seconds > 0 {
+			if t := time.Duration(seconds * float64(time.Second)); t < timeout {
+				timeout = t
+			}
+		}
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := writeMetrics(w, e.collect(ctx)); err != nil {
+		log.Printf("输出指标失败:%v", err)
+	}
+}
+
+//并发采集所有实例的指标
+func (e *Exporter) collect(ctx context.Context) []metricSample {
+	results := make([][]metricSample, len(e.targets))
+	var wg sync.WaitGroup
+	for i, target := range e.targets {
+		wg.Add(1)
+		go func(i int, target ExporterTarget) {
+			defer wg.Done()
+			results[i] = e.collectTarget(ctx, target)
+		}(i, target)
+	}
+	wg.Wait()
+	samples := make([]metricSample, 0)
+	for _, result := range results {
+		samples = append(samples, result...)
+	}
+	return samples
+}
+
+//采集一个实例的指标,全局状态采集失败时认为实例不可用,参数和复制状态采集失败时只记录日志
+func (e *Exporter) collectTarget(ctx context.Context, target ExporterTarget) []metricSample {
+	start := time.Now()
+	targetLabel := [2]string{"target", target.Instance}
+	samples := make([]metricSample, 0)
+	up := 1.0
+	if status, err := target.Handler.ShowGlobalStatusContext(ctx); err != nil {
+		log.Printf("采集实例%s的状态失败:%v", target.Instance, err)
+		up = 0
+	} else {
+		samples = append(samples, statusSamples(targetLabel, status)...)
+		if variables, err := target.Handler.ShowGlobalVariablesContext(ctx); err != nil {
+			log.Printf("采集实例%s的参数失败:%v", target.Instance, err)
+		} else {
+			samples = append(samples, variableSamples(targetLabel, variables, e.o.Variables)...)
+		}
+		if replicaSamples, err := e.collectReplica(ctx, target.Handler, targetLabel); err != nil {
+			log.Printf("采集实例%s的复制状态失败:%v", target.Instance, err)
+		} else {
+			samples = append(samples, replicaSamples...)
+		}
+	}
+	samples = append(samples,
+		metricSample{Name: metricNamespace + "_up", Help: "Whether the last scrape of the instance succeeded.", Type: "gauge", Labels: [][2]string{targetLabel}, Value: up},
+		metricSample{Name: metricNamespace + "_scrape_duration_seconds", Help: "Time spent scraping the instance.", Type: "gauge", Labels: [][2]string{targetLabel}, Value: time.Since(start).Seconds()},
+	)
+	return samples
+}
+
+//复制状态和延迟,非从库时没有复制相关的指标
+func (e *Exporter) collectReplica(ctx context.Context, d *DBHandler, targetLabel [2]string) ([]metricSample, error) {
+	statusList, err := d.ShowReplicaStatusContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]metricSample, 0)
+	if len(statusList) == 0 {
+		return samples, nil
+	}
+	for _, s := range statusList {
+		labels := [][2]string{targetLabel, {"channel", s.Channel}, {"source", fmt.Sprintf("%s:%d", s.SourceHost, s.SourcePort)}}
+		samples = append(samples,
+			metricSample{Name: metricNamespace + "_replica_io_running", Help: "Whether the replica IO thread is running.", Type: "gauge", Labels: labels, Value: boolValue(s.IOThreadRunning())},
+			metricSample{Name: metricNamespace + "_replica_sql_running", Help: "Whether the replica SQL thread is running.", Type: "gauge", Labels: labels, Value: boolValue(s.SQLThreadRunning())},
+			metricSample{Name: metricNamespace + "_replica_last_errno", Help: "Last IO or SQL error number of the replica.", Type: "gauge", Labels: labels, Value: float64(s.LastIOErrno + s.LastSQLErrno)},
+		)
+		if s.SecondsBehind >= 0 {
+			samples = append(samples, metricSample{Name: metricNamespace + "_replica_seconds_behind_source", Help: "Seconds_Behind_Source of the replica.", Type: "gauge", Labels: labels, Value: float64(s.SecondsBehind)})
+		}
+	}
+	if lag, err := d.ReplicationLagContext(ctx, e.o.Heartbeat); err == nil {
+		samples = append(samples, metricSample{Name: metricNamespace + "_replica_lag_seconds", Help: "Replication lag of the replica, max of all channels.", Type: "gauge", Labels: [][2]string{targetLabel, {"method", lag.Method}}, Value: lag.Lag.Seconds()})
+	} else if ctx.Err() != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
+//一个指标的样本
+type metricSample struct {
+	Name   string
+	Help   string
+	Type   string //counter或gauge
+	Labels [][2]string
+	Value  float64
+}
+
+//全局状态转换为指标,只导出数字类型的状态,计数器的指标类型为counter,指标名以_total结尾
+func statusSamples(targetLabel [2]string, status map[string]string) []metricSample {
+	samples := make([]metricSample, 0, len(status))
+	for name, value := range status {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		typ, suffix := "gauge", ""
+		if isStatusCounter(name) {
+			typ, suffix = "counter", "_total"
+		}
+		samples = append(samples, metricSample{
+			Name:   metricNamespace + "_global_status_" + metricName(name) + suffix,
+			Help:   "Generic metric from SHOW GLOBAL STATUS.",
+			Type:   typ,
+			Labels: [][2]string{targetLabel},
+			Value:  f,
+		})
+	}
+	return samples
+}
+
+//参数转换为指标,只导出names中数字和ON/OFF类型的参数
+func variableSamples(targetLabel [2]string, variables map[string]string, names []string) []metricSample {
+	samples := make([]metricSample, 0, len(names))
+	for _, name := range names {
+		value, ok := variables[strings.ToLower(name)]
+		if !ok {
+			continue
+		}
+		f, ok := variableValue(value)
+		if !ok {
+			continue
+		}
+		samples = append(samples, metricSample{
+			Name:   metricNamespace + "_global_variables_" + metricName(name),
+			Help:   "Generic gauge metric from SHOW GLOBAL VARIABLES.",
+			Type:   "gauge",
+			Labels: [][2]string{targetLabel},
+			Value:  f,
+		})
+	}
+	return samples
+}
+
+//将参数值转换为数字,ON/YES为1,OFF/NO为0
+func variableValue(value string) (float64, bool) {
+	switch strings.ToUpper(value) {
+	case "ON", "YES":
+		return 1, true
+	case "OFF", "NO":
+		return 0, true
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	return f, err == nil
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+//转换为合法的指标名,小写,非字母数字的字符替换为下划线
+func metricName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '_'
+	}, name)
+}
+
+//按照Prometheus文本格式输出,同名的指标放在一起且只输出一次HELP和TYPE
+func writeMetrics(w io.Writer, samples []metricSample) error {
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Name < samples[j].Name
+	})
+	bw := bufio.NewWriter(w)
+	for i, s := range samples {
+		if i == 0 || samples[i-1].Name != s.Name {
+			fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", s.Name, s.Help, s.Name, s.Type)
+		}
+		bw.WriteString(s.Name)
+		if len(s.Labels) > 0 {
+			labels := make([]string, 0, len(s.Labels))
+			for _, l := range s.Labels {
+				labels = append(labels, l[0]+`="`+escapeLabelValue(l[1])+`"`)
+			}
+			bw.WriteString("{" + strings.Join(labels, ",") + "}")
+		}
+		bw.WriteString(" " + formatMetricValue(s.Value) + "\n")
+	}
+	return bw.Flush()
+}
+
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMetricName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Com_select", "com_select"},
+		{"Innodb_buffer_pool_pages_data", "innodb_buffer_pool_pages_data"},
+		{"Performance_schema_file_instances_lost", "performance_schema_file_instances_lost"},
+		{"Ssl.weird-name", "ssl_weird_name"},
+	}
+	for _, tt := range tests {
+		if got := metricName(tt.name); got != tt.want {
+			t.Errorf("metricName(%s)=%s,want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestVariableSamples(t *testing.T) {
+	targetLabel := [2]string{"target", "db1"}
+	variables := map[string]string{"max_connections": "151", "read_only": "ON", "sql_mode": "STRICT_TRANS_TABLES"}
+	samples := variableSamples(targetLabel, variables, []string{"max_connections", "read_only", "sql_mode", "not_exists"})
+	if len(samples) != 2 || samples[0].Name != "mysql_global_variables_max_connections" || samples[0].Value != 151 || samples[1].Value != 1 {
+		t.Errorf("unexpected samples:%+v", samples)
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	db1 := [2]string{"target", "db1"}
+	db2 := [2]string{"target", `db"2`}
+	samples := append(statusSamples(db1, map[string]string{"Questions": "10", "Threads_running": "2", "Ssl_cipher": ""}),
+		statusSamples(db2, map[string]string{"Questions": "20"})...)
+	var buf bytes.Buffer
+	if err := writeMetrics(&buf, samples); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP mysql_global_status_questions_total Generic metric from SHOW GLOBAL STATUS.
+# TYPE mysql_global_status_questions_total counter
+mysql_global_status_questions_total{target="db1"} 10
+mysql_global_status_questions_total{target="db\"2"} 20
+# HELP mysql_global_status_threads_running Generic metric from SHOW GLOBAL STATUS.
+# TYPE mysql_global_status_threads_running gauge
+mysql_global_status_threads_running{target="db1"} 2
+`
+	if buf.String() != want {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+}
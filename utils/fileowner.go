@@ -0,0 +1,24 @@
+//go:build !windows && !plan9
+
+package utils
+
+import (
+	"os"
+	"syscall"
+)
+
+//将文件的属主设置为与finfo相同,属主已经相同时不修改
+func chownLike(f *os.File, finfo os.FileInfo) error {
+	want, ok := finfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	current, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if got, ok := current.Sys().(*syscall.Stat_t); ok && got.Uid == want.Uid && got.Gid == want.Gid {
+		return nil
+	}
+	return f.Chown(int(want.Uid), int(want.Gid))
+}
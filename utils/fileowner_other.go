@@ -0,0 +1,10 @@
+//go:build windows || plan9
+
+package utils
+
+import "os"
+
+//该平台上没有uid和gid,不需要修改属主
+func chownLike(f *os.File, finfo os.FileInfo) error {
+	return nil
+}
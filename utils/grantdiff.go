@@ -0,0 +1,354 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+)
+
+//单个权限在某个权限级别上的授权,是权限比较的最小单位
+type privUnit struct {
+	ObjectType string
+	Level      string
+	Privilege  string //单个权限,列权限拆分成每一列一个,如SELECT (`c1`)
+	Revoked    bool   //部分回收权限
+}
+
+//某个权限级别上的权限差异
+type LevelDiff struct {
+	ObjectType string
+	Level      string
+	Revoked    bool     //是否为部分回收权限(partial_revokes)的差异
+	Added      []string //目标账号比源账号多出的权限
+	Removed    []string //目标账号比源账号缺少的权限
+}
+
+//两个账号之间的权限差异,以源账号为基准
+type GrantDiff struct {
+	Account      Account      //目标账号,Statements在该账号上执行
+	Levels       []*LevelDiff //按权限级别汇总的差异
+	AddedRoles   []Account    //目标账号比源账号多出的角色
+	RemovedRoles []Account    //目标账号比源账号缺少的角色
+	AdminRoles   []Account    //两个账号都有但WITH ADMIN OPTION不一致的角色
+	Statements   []string     //在目标实例上执行后使目标账号与源账号权限一致的GRANT/REVOKE语句
+}
+
+//两个账号的权限是否完全一致
+func (g *GrantDiff) Equal() bool {
+	return len(g.Levels) == 0 && len(g.AddedRoles) == 0 && len(g.RemovedRoles) == 0 && len(g.AdminRoles) == 0
+}
+
+//比较当前实例上的账号和target实例上账号的权限,target可以是当前实例本身
+//返回的差异以当前实例上的账号为基准,Statements在target上执行后两者权限一致
+func (d *DBHandler) DiffGrants(user, host string, target *DBHandler, targetUser, targetHost string) (*GrantDiff, error) {
+	return d.DiffGrantsContext(context.Background(), user, host, target, targetUser, targetHost)
+}
+
+//同DiffGrants,ctx用于超时和取消控制
+func (d *DBHandler) DiffGrantsContext(ctx context.Context, user, host string, target *DBHandler, targetUser, targetHost string) (*GrantDiff, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	if host == "" {
+		host = "%"
+	}
+	if targetHost == "" {
+		targetHost = "%"
+	}
+	source, err := d.ShowGrantsContext(ctx, user, host)
+	if err != nil {
+		return nil, err
+	}
+	current, err := target.ShowGrantsContext(ctx, targetUser, targetHost)
+	if err != nil {
+		return nil, err
+	}
+	return diffPrivileges(source, current, Account{User: targetUser, Host: targetHost}), nil
+}
+
+//5.7和8.0中ALL PRIVILEGES ON *.*都包含的静态权限,8.0还包含CREATE ROLE、DROP ROLE以及所有动态权限
+var globalAllPrivileges = []string{
+	"SELECT", "INSERT", "UPDATE", "DELETE", "CREATE", "DROP", "RELOAD", "SHUTDOWN", "PROCESS", "FILE",
+	"REFERENCES", "INDEX", "ALTER", "SHOW DATABASES", "SUPER", "CREATE TEMPORARY TABLES", "LOCK TABLES",
+	"EXECUTE", "REPLICATION SLAVE", "REPLICATION CLIENT", "CREATE VIEW", "SHOW VIEW", "CREATE ROUTINE",
+	"ALTER ROUTINE", "CREATE USER", "EVENT", "TRIGGER", "CREATE TABLESPACE",
+}
+
+var globalAllUnit = privUnit{Level: "*.*", Privilege: "ALL PRIVILEGES"}
+
+//8.0的SHOW GRANTS把全局的ALL PRIVILEGES展开成静态权限列表和单独一行的动态权限
+//包含全部静态权限的全局授权合并成ALL PRIVILEGES,使展开和未展开的两种写法一致
+func collapseGlobalAll(units map[privUnit]bool) {
+	for _, priv := range globalAllPrivileges {
+		if !units[privUnit{Level: "*.*", Privilege: priv}] {
+			return
+		}
+	}
+	for _, priv := range append([]string{"CREATE ROLE", "DROP ROLE"}, globalAllPrivileges...) {
+		delete(units, privUnit{Level: "*.*", Privilege: priv})
+	}
+	units[globalAllUnit] = true
+}
+
+//全局的动态权限,如BACKUP_ADMIN,动态权限名中包含下划线而静态权限不包含
+func isGlobalDynamicPriv(u privUnit) bool {
+	return u.Level == "*.*" && u.ObjectType == "" && !u.Revoked && strings.Contains(u.Privilege, "_")
+}
+
+//比较期望的权限和当前的权限,生成使account的当前权限变成期望权限的语句
+func diffPrivileges(desired, current []*Privilege, account Account) *GrantDiff {
+	desiredUnits, desiredRoles := splitPrivUnits(desired)
+	currentUnits, currentRoles := splitPrivUnits(current)
+	collapseGlobalAll(desiredUnits)
+	collapseGlobalAll(currentUnits)
+	//期望全局ALL PRIVILEGES时已经包含所有动态权限,不同版本和插件的动态权限列表不同,不再逐个比较
+	if desiredUnits[globalAllUnit] {
+		for _, units := range []map[privUnit]bool{desiredUnits, currentUnits} {
+			for u := range units {
+				if isGlobalDynamicPriv(u) {
+					delete(units, u)
+				}
+			}
+		}
+	}
+	diff := &GrantDiff{Account: account}
+	levels := make(map[privUnit]*LevelDiff, 0)
+	levelOf := func(u privUnit) *LevelDiff {
+		key := privUnit{ObjectType: u.ObjectType, Level: u.Level, Revoked: u.Revoked}
+		if levels[key] == nil {
+			levels[key] = &LevelDiff{ObjectType: u.ObjectType, Level: u.Level, Revoked: u.Revoked}
+			diff.Levels = append(diff.Levels, levels[key])
+		}
+		return levels[key]
+	}
+	for _, u := range sortedPrivUnits(currentUnits) {
+		if !desiredUnits[u] {
+			l := levelOf(u)
+			l.Added = append(l.Added, u.Privilege)
+		}
+	}
+	for _, u := range sortedPrivUnits(desiredUnits) {
+		if !currentUnits[u] {
+			l := levelOf(u)
+			l.Removed = append(l.Removed, u.Privilege)
+		}
+	}
+	sort.Slice(diff.Levels, func(i, j int) bool {
+		a, b := diff.Levels[i], diff.Levels[j]
+		if a.Revoked != b.Revoked {
+			return !a.Revoked
+		}
+		if a.Level != b.Level {
+			return a.Level < b.Level
+		}
+		return a.ObjectType < b.ObjectType
+	})
+	for _, r := range sortedAccounts(currentRoles) {
+		if _, ok := desiredRoles[r]; !ok {
+			diff.AddedRoles = append(diff.AddedRoles, r)
+		}
+	}
+	for _, r := range sortedAccounts(desiredRoles) {
+		if admin, ok := currentRoles[r]; !ok {
+			diff.RemovedRoles = append(diff.RemovedRoles, r)
+		} else if admin != desiredRoles[r] {
+			diff.AdminRoles = append(diff.AdminRoles, r)
+		}
+	}
+	diff.Statements = reconcileStatements(diff, desiredRoles)
+	return diff
+}
+
+//生成使目标账号与源账号一致的语句,先回收多出的权限再补齐缺少的权限,最后处理部分回收权限
+//必须先回收:目标账号有ALL PRIVILEGES而源账号只有其中一部分时,先GRANT部分权限不起作用,随后REVOKE ALL会把权限全部回收
+func reconcileStatements(diff *GrantDiff, desiredRoles map[Account]bool) []string {
+	var (
+		grants   []string
+		revokes  []string
+		partials []string
+		to       = diff.Account.String()
+	)
+	for _, l := range diff.Levels {
+		on := l.Level
+		if l.ObjectType != "" {
+			on = l.ObjectType + " " + l.Level
+		}
+		//部分回收权限的差异需要反向处理:缺少的REVOKE行需要执行REVOKE,多出的REVOKE行需要执行GRANT
+		if l.Revoked {
+			if len(l.Removed) > 0 {
+				partials = append(partials, fmt.Sprintf("REVOKE %s ON %s FROM %s", strings.Join(l.Removed, ","), on, to))
+			}
+			if len(l.Added) > 0 {
+				partials = append(partials, fmt.Sprintf("GRANT %s ON %s TO %s", strings.Join(l.Added, ","), on, to))
+			}
+			continue
+		}
+		if len(l.Removed) > 0 {
+			grants = append(grants, fmt.Sprintf("GRANT %s ON %s TO %s", strings.Join(l.Removed, ","), on, to))
+		}
+		if len(l.Added) > 0 {
+			revokes = append(revokes, fmt.Sprintf("REVOKE %s ON %s FROM %s", strings.Join(l.Added, ","), on, to))
+		}
+	}
+	for _, r := range diff.RemovedRoles {
+		grantRoleSQL := fmt.Sprintf("GRANT %s TO %s", r, to)
+		if desiredRoles[r] {
+			grantRoleSQL += " WITH ADMIN OPTION"
+		}
+		grants = append(grants, grantRoleSQL)
+	}
+	for _, r := range diff.AddedRoles {
+		revokes = append(revokes, fmt.Sprintf("REVOKE %s FROM %s", r, to))
+	}
+	//MySQL没有单独回收ADMIN OPTION的语法,需要先回收角色再重新授予
+	for _, r := range diff.AdminRoles {
+		if desiredRoles[r] {
+			grants = append(grants, fmt.Sprintf("GRANT %s TO %s WITH ADMIN OPTION", r, to))
+			continue
+		}
+		revokes = append(revokes, fmt.Sprintf("REVOKE %s FROM %s", r, to))
+		grants = append(grants, fmt.Sprintf("GRANT %s TO %s", r, to))
+	}
+	statements := make([]string, 0, len(grants)+len(revokes)+len(partials))
+	statements = append(statements, revokes...)
+	statements = append(statements, grants...)
+	return append(statements, partials...)
+}
+
+//将授权拆分成最小的权限单位,角色授权单独返回,value表示是否WITH ADMIN OPTION
+func splitPrivUnits(privs []*Privilege) (map[privUnit]bool, map[Account]bool) {
+	units := make(map[privUnit]bool, 0)
+	roles := make(map[Account]bool, 0)
+	for _, p := range privs {
+		for _, r := range p.Roles {
+			roles[r] = roles[r] || p.GrantOption
+		}
+		objectType := p.ObjectType
+		if objectType == "TABLE" {
+			objectType = ""
+		}
+		add := func(priv string) {
+			units[privUnit{ObjectType: objectType, Level: p.Level, Privilege: priv, Revoked: p.Revoked}] = true
+		}
+		for _, priv := range p.Privileges {
+			switch priv {
+			case "USAGE":
+				//USAGE表示没有任何权限
+				continue
+			case "ALL":
+				priv = "ALL PRIVILEGES"
+			}
+			//列权限拆分成每一列一个
+			if subMatch := columnPrivPattern.FindStringSubmatch(priv); len(subMatch) != 0 {
+				for _, col := range splitTopLevel(priv[strings.Index(priv, "(")+1:strings.LastIndex(priv, ")")], ',') {
+					add(fmt.Sprintf("%s (%s)", subMatch[1], col))
+				}
+				continue
+			}
+			add(priv)
+		}
+		if p.GrantOption && !p.IsRoleGrant() {
+			add("GRANT OPTION")
+		}
+	}
+	return units, roles
+}
+
+func sortedPrivUnits(units map[privUnit]bool) []privUnit {
+	list := make([]privUnit, 0, len(units))
+	for u := range units {
+		list = append(list, u)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Level != b.Level {
+			return a.Level < b.Level
+		}
+		if a.ObjectType != b.ObjectType {
+			return a.ObjectType < b.ObjectType
+		}
+		return a.Privilege < b.Privilege
+	})
+	return list
+}
+
+func sortedAccounts(accounts map[Account]bool) []Account {
+	list := make([]Account, 0, len(accounts))
+	for a := range accounts {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].User != list[j].User {
+			return list[i].User < list[j].User
+		}
+		return list[i].Host < list[j].Host
+	})
+	return list
+}
+
+//将账号的权限调整为desired描述的状态,只执行必要的GRANT/REVOKE语句
+//desired中的Privileges、ObjectType、Level、GrantOption、Roles、Revoked会被使用,Level可以不带反引号,如db1.*
+//dryRun为true时只返回执行计划而不执行;执行失败时返回的GrantDiff仍然包含完整的执行计划
+func (d *DBHandler) ApplyGrants(user, host string, desired []Privilege, dryRun bool) (*GrantDiff, error) {
+	return d.ApplyGrantsContext(context.Background(), user, host, desired, dryRun)
+}
+
+//同ApplyGrants,ctx用于超时和取消控制
+func (d *DBHandler) ApplyGrantsContext(ctx context.Context, user, host string, desired []Privilege, dryRun bool) (*GrantDiff, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	if host == "" {
+		host = "%"
+	}
+	desiredPrivs, err := normalizePrivileges(desired)
+	if err != nil {
+		return nil, err
+	}
+	current, err := d.ShowGrantsContext(ctx, user, host)
+	if err != nil {
+		return nil, err
+	}
+	diff := diffPrivileges(desiredPrivs, current, Account{User: user, Host: host})
+	if dryRun {
+		return diff, nil
+	}
+	for _, stmt := range diff.Statements {
+		if _, err := d.conn.ExecContext(ctx, stmt); err != nil {
+			return diff, errors.Wrap(err, stmt)
+		}
+	}
+	return diff, nil
+}
+
+//校验并格式化外部传入的权限描述,使其与ShowGrants的解析结果具有相同的形式
+func normalizePrivileges(privs []Privilege) ([]*Privilege, error) {
+	list := make([]*Privilege, 0, len(privs))
+	for _, p := range privs {
+		n := &Privilege{GrantOption: p.GrantOption, Revoked: p.Revoked}
+		if len(p.Privileges) > 0 {
+			var err error
+			for _, priv := range p.Privileges {
+				f, err := formatPrivilege(priv)
+				if err != nil {
+					return nil, err
+				}
+				n.Privileges = append(n.Privileges, f)
+			}
+			if n.ObjectType, err = formatObjectType(p.ObjectType); err != nil {
+				return nil, err
+			}
+			if n.Level, err = formatPrivLevel(p.Level); err != nil {
+				return nil, err
+			}
+		}
+		for _, r := range p.Roles {
+			if r.Host == "" {
+				r.Host = "%"
+			}
+			n.Roles = append(n.Roles, r)
+		}
+		list = append(list, n)
+	}
+	return list, nil
+}
@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func mustParseGrants(t *testing.T, lines ...string) []*Privilege {
+	privs := make([]*Privilege, 0, len(lines))
+	for _, line := range lines {
+		p, err := parseGrant(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		privs = append(privs, p)
+	}
+	return privs
+}
+
+func TestDiffPrivileges(t *testing.T) {
+	source := mustParseGrants(t,
+		"GRANT USAGE ON *.* TO `app`@`%`",
+		"GRANT SELECT, INSERT ON `db1`.* TO `app`@`%` WITH GRANT OPTION",
+		"GRANT SELECT (`id`, `name`) ON `db1`.`t1` TO `app`@`%`",
+		"GRANT `r1`@`%` TO `app`@`%`",
+	)
+	target := mustParseGrants(t,
+		"GRANT PROCESS ON *.* TO `app`@`%`",
+		"GRANT SELECT ON `db1`.* TO `app`@`%`",
+		"GRANT SELECT (`id`) ON `db1`.`t1` TO `app`@`%`",
+		"GRANT `r2`@`%` TO `app`@`%`",
+	)
+	diff := diffPrivileges(source, target, Account{User: "app", Host: "%"})
+	if diff.Equal() {
+		t.Fatal("diff should not be equal")
+	}
+	wantLevels := []*LevelDiff{
+		{Level: "*.*", Added: []string{"PROCESS"}},
+		{Level: "`db1`.*", Removed: []string{"GRANT OPTION", "INSERT"}},
+		{Level: "`db1`.`t1`", Removed: []string{"SELECT (`name`)"}},
+	}
+	if !reflect.DeepEqual(diff.Levels, wantLevels) {
+		for _, l := range diff.Levels {
+			t.Logf("%+v", *l)
+		}
+		t.Errorf("levels mismatch")
+	}
+	if !reflect.DeepEqual(diff.AddedRoles, []Account{{"r2", "%"}}) || !reflect.DeepEqual(diff.RemovedRoles, []Account{{"r1", "%"}}) {
+		t.Errorf("roles mismatch: added=%v removed=%v", diff.AddedRoles, diff.RemovedRoles)
+	}
+	wantStatements := []string{
+		"REVOKE PROCESS ON *.* FROM 'app'@'%'",
+		"REVOKE 'r2'@'%' FROM 'app'@'%'",
+		"GRANT GRANT OPTION,INSERT ON `db1`.* TO 'app'@'%'",
+		"GRANT SELECT (`name`) ON `db1`.`t1` TO 'app'@'%'",
+		"GRANT 'r1'@'%' TO 'app'@'%'",
+	}
+	if !reflect.DeepEqual(diff.Statements, wantStatements) {
+		t.Errorf("statements mismatch:\n got:%q\nwant:%q", diff.Statements, wantStatements)
+	}
+}
+
+func TestDiffPrivileges_Equal(t *testing.T) {
+	source := mustParseGrants(t,
+		"GRANT SELECT, INSERT ON `db1`.* TO `app`@`%`",
+		"GRANT EXECUTE ON PROCEDURE `db1`.`p1` TO `app`@`%`",
+	)
+	target := mustParseGrants(t,
+		"GRANT USAGE ON *.* TO 'app2'@'10.%'",
+		"GRANT INSERT,SELECT ON `db1`.* TO 'app2'@'10.%'",
+		"GRANT EXECUTE ON PROCEDURE `db1`.`p1` TO 'app2'@'10.%'",
+	)
+	if diff := diffPrivileges(source, target, Account{User: "app2", Host: "10.%"}); !diff.Equal() || len(diff.Statements) != 0 {
+		t.Errorf("diff should be equal:%+v", diff)
+	}
+}
+
+func TestDiffPrivileges_PartialRevoke(t *testing.T) {
+	source := mustParseGrants(t,
+		"GRANT SELECT ON *.* TO `app`@`%`",
+		"REVOKE SELECT ON `mysql`.* FROM `app`@`%`",
+	)
+	target := mustParseGrants(t,
+		"GRANT SELECT ON *.* TO `app`@`%`",
+	)
+	diff := diffPrivileges(source, target, Account{User: "app", Host: "%"})
+	want := []string{"REVOKE SELECT ON `mysql`.* FROM 'app'@'%'"}
+	if !reflect.DeepEqual(diff.Statements, want) {
+		t.Errorf("statements mismatch:\n got:%q\nwant:%q", diff.Statements, want)
+	}
+}
+
+func TestDiffPrivileges_AllToSubset(t *testing.T) {
+	source := mustParseGrants(t,
+		"GRANT SELECT, INSERT ON `db1`.* TO `app`@`%`",
+	)
+	target := mustParseGrants(t,
+		"GRANT ALL PRIVILEGES ON `db1`.* TO `app`@`%`",
+	)
+	diff := diffPrivileges(source, target, Account{User: "app", Host: "%"})
+	//先GRANT再REVOKE ALL会导致账号没有任何权限
+	want := []string{
+		"REVOKE ALL PRIVILEGES ON `db1`.* FROM 'app'@'%'",
+		"GRANT INSERT,SELECT ON `db1`.* TO 'app'@'%'",
+	}
+	if !reflect.DeepEqual(diff.Statements, want) {
+		t.Errorf("statements mismatch:\n got:%q\nwant:%q", diff.Statements, want)
+	}
+}
+
+func TestDiffPrivileges_GlobalAll(t *testing.T) {
+	account := Account{User: "admin", Host: "%"}
+	desired := mustParseGrants(t, "GRANT ALL PRIVILEGES ON *.* TO `admin`@`%` WITH GRANT OPTION")
+	//8.0的SHOW GRANTS把全局ALL展开成静态权限和动态权限两行
+	expanded := mustParseGrants(t,
+		"GRANT SELECT, INSERT, UPDATE, DELETE, CREATE, DROP, RELOAD, SHUTDOWN, PROCESS, FILE, REFERENCES, INDEX, ALTER, "+
+			"SHOW DATABASES, SUPER, CREATE TEMPORARY TABLES, LOCK TABLES, EXECUTE, REPLICATION SLAVE, REPLICATION CLIENT, "+
+			"CREATE VIEW, SHOW VIEW, CREATE ROUTINE, ALTER ROUTINE, CREATE USER, EVENT, TRIGGER, CREATE TABLESPACE, "+
+			"CREATE ROLE, DROP ROLE ON *.* TO `admin`@`%` WITH GRANT OPTION",
+		"GRANT APPLICATION_PASSWORD_ADMIN,AUDIT_ADMIN,BACKUP_ADMIN,BINLOG_ADMIN,XA_RECOVER_ADMIN ON *.* TO `admin`@`%` WITH GRANT OPTION",
+	)
+	if diff := diffPrivileges(desired, expanded, account); !diff.Equal() {
+		t.Errorf("expanded ALL should equal ALL PRIVILEGES:%q", diff.Statements)
+	}
+	if diff := diffPrivileges(expanded, desired, account); !diff.Equal() {
+		t.Errorf("ALL PRIVILEGES should equal expanded ALL:%q", diff.Statements)
+	}
+	//缺少一个静态权限时需要重新授予ALL
+	partial := mustParseGrants(t,
+		"GRANT SELECT, INSERT ON *.* TO `admin`@`%` WITH GRANT OPTION",
+		"GRANT BACKUP_ADMIN ON *.* TO `admin`@`%`",
+	)
+	want := []string{
+		"REVOKE INSERT,SELECT ON *.* FROM 'admin'@'%'",
+		"GRANT ALL PRIVILEGES ON *.* TO 'admin'@'%'",
+	}
+	if diff := diffPrivileges(desired, partial, account); !reflect.DeepEqual(diff.Statements, want) {
+		t.Errorf("statements mismatch:\n got:%q\nwant:%q", diff.Statements, want)
+	}
+}
+
+func TestDiffPrivileges_RoleAdminOption(t *testing.T) {
+	account := Account{User: "app", Host: "%"}
+	withAdmin := mustParseGrants(t, "GRANT `r1`@`%`,`r2`@`%` TO `app`@`%` WITH ADMIN OPTION")
+	withoutAdmin := mustParseGrants(t, "GRANT `r1`@`%`,`r2`@`%` TO `app`@`%`")
+	diff := diffPrivileges(withAdmin, withoutAdmin, account)
+	want := []string{
+		"GRANT 'r1'@'%' TO 'app'@'%' WITH ADMIN OPTION",
+		"GRANT 'r2'@'%' TO 'app'@'%' WITH ADMIN OPTION",
+	}
+	if diff.Equal() || !reflect.DeepEqual(diff.Statements, want) {
+		t.Errorf("statements mismatch:\n got:%q\nwant:%q", diff.Statements, want)
+	}
+	diff = diffPrivileges(withoutAdmin, withAdmin, account)
+	want = []string{
+		"REVOKE 'r1'@'%' FROM 'app'@'%'",
+		"REVOKE 'r2'@'%' FROM 'app'@'%'",
+		"GRANT 'r1'@'%' TO 'app'@'%'",
+		"GRANT 'r2'@'%' TO 'app'@'%'",
+	}
+	if diff.Equal() || !reflect.DeepEqual(diff.Statements, want) {
+		t.Errorf("statements mismatch:\n got:%q\nwant:%q", diff.Statements, want)
+	}
+}
+
+func TestNormalizePrivileges(t *testing.T) {
+	desired := []Privilege{
+		{Privileges: []string{"select", "insert"}, Level: "db1.*"},
+		{Privileges: []string{"execute"}, ObjectType: "procedure", Level: "db1.p1"},
+		{Roles: []Account{{User: "app_ro"}}},
+	}
+	got, err := normalizePrivileges(desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := mustParseGrants(t,
+		"GRANT SELECT, INSERT ON `db1`.* TO `u1`@`%`",
+		"GRANT EXECUTE ON PROCEDURE `db1`.`p1` TO `u1`@`%`",
+		"GRANT `app_ro`@`%` TO `u1`@`%`",
+	)
+	if diff := diffPrivileges(got, current, Account{User: "u1", Host: "%"}); !diff.Equal() {
+		t.Errorf("normalized privileges should equal current grants:%q", diff.Statements)
+	}
+	if desired[2].Roles[0].Host != "" {
+		t.Errorf("normalizePrivileges should not modify its input")
+	}
+	if _, err := normalizePrivileges([]Privilege{{Privileges: []string{"SELECT"}, Level: "*.t1"}}); err == nil {
+		t.Errorf("invalid level should fail")
+	}
+}
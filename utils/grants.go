@@ -0,0 +1,313 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+//数据库账号,也用于表示角色
+type Account struct {
+	User string
+	Host string
+}
+
+//转换成'user'@'host'形式
+func (a Account) String() string {
+	return userName(a.User, a.Host)
+}
+
+//SHOW GRANTS中的一行授权信息
+//GRANT SELECT, INSERT ON `db1`.* TO `u1`@`%` WITH GRANT OPTION
+//GRANT `r1`@`%`,`r2`@`%` TO `u1`@`localhost`
+type Privilege struct {
+	Privileges  []string  //权限列表,如SELECT,INSERT,SELECT (`c1`);角色授权时为空
+	ObjectType  string    //TABLE,FUNCTION,PROCEDURE,为空时表示TABLE
+	Level       string    //权限级别,如*.*,`db1`.*,`db1`.`t1`
+	GrantOption bool      //是否WITH GRANT OPTION,角色授权时表示WITH ADMIN OPTION
+	Roles       []Account //授予的角色
+	Revoked     bool      //部分回收权限(partial_revokes)产生的REVOKE行
+	Grant       string    //原始的授权语句
+}
+
+//是否为角色授权
+func (p *Privilege) IsRoleGrant() bool {
+	return len(p.Roles) > 0
+}
+
+//查看用户的所有授权,并解析成结构化的权限信息
+func (d *DBHandler) ShowGrants(user, host string) ([]*Privilege, error) {
+	return d.ShowGrantsContext(context.Background(), user, host)
+}
+
+//同ShowGrants,ctx用于超时和取消控制
+func (d *DBHandler) ShowGrantsContext(ctx context.Context, user, host string) ([]*Privilege, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	lines, err := d.showGrantLines(ctx, user, host)
+	if err != nil {
+		return nil, err
+	}
+	privs := make([]*Privilege, 0, len(lines))
+	for _, line := range lines {
+		p, err := parseGrant(line)
+		if err != nil {
+			return nil, err
+		}
+		privs = append(privs, p)
+	}
+	return privs, nil
+}
+
+//查看用户的所有授权语句
+func (d *DBHandler) showGrantLines(ctx context.Context, user, host string) ([]string, error) {
+	rows, err := d.conn.QueryContext(ctx, fmt.Sprintf("SHOW GRANTS FOR %s", userName(user, host)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var (
+		line  string
+		lines = make([]string, 0)
+	)
+	for rows.Next() {
+		if err := rows.Scan(&line); err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+//解析SHOW GRANTS输出的一行授权语句
+func parseGrant(line string) (*Privilege, error) {
+	line = strings.TrimSpace(line)
+	p := &Privilege{Grant: line}
+	var (
+		body string
+		toKw = "TO"
+	)
+	switch upper := strings.ToUpper(line); {
+	case strings.HasPrefix(upper, "GRANT "):
+		body = line[len("GRANT "):]
+	case strings.HasPrefix(upper, "REVOKE "):
+		body = line[len("REVOKE "):]
+		toKw = "FROM"
+		p.Revoked = true
+	default:
+		return nil, errors.New("无法解析授权语句:" + line)
+	}
+	toIdx := indexKeyword(body, toKw)
+	if toIdx < 0 {
+		return nil, errors.New("无法解析授权语句:" + line)
+	}
+	head, tail := body[:toIdx], body[toIdx+len(toKw):]
+	onIdx := indexKeyword(head, "ON")
+	//没有ON关键字的是角色授权
+	if onIdx < 0 {
+		for _, r := range splitTopLevel(head, ',') {
+			role, err := parseAccount(r)
+			if err != nil {
+				return nil, errors.Wrap(err, "无法解析授权语句:"+line)
+			}
+			p.Roles = append(p.Roles, role)
+		}
+		p.GrantOption = indexKeyword(tail, "WITH ADMIN OPTION") >= 0
+		return p, nil
+	}
+	for _, priv := range splitTopLevel(head[:onIdx], ',') {
+		f, err := formatPrivilege(priv)
+		if err != nil {
+			return nil, errors.Wrap(err, "无法解析授权语句:"+line)
+		}
+		p.Privileges = append(p.Privileges, f)
+	}
+	object := strings.TrimSpace(head[onIdx+len("ON"):])
+	for _, t := range []string{"TABLE", "FUNCTION", "PROCEDURE"} {
+		if strings.HasPrefix(strings.ToUpper(object), t+" ") {
+			p.ObjectType = t
+			object = strings.TrimSpace(object[len(t):])
+			break
+		}
+	}
+	if len(p.Privileges) == 1 && p.Privileges[0] == "PROXY" {
+		//GRANT PROXY ON ''@'' TO ...,权限级别是被代理的用户
+		p.Level = object
+	} else {
+		level, err := formatPrivLevel(object)
+		if err != nil {
+			return nil, errors.Wrap(err, "无法解析授权语句:"+line)
+		}
+		p.Level = level
+	}
+	p.GrantOption = indexKeyword(tail, "WITH GRANT OPTION") >= 0
+	return p, nil
+}
+
+//解析'user'@'host',`user`@`host`或user@host形式的账号,省略host时为%
+func parseAccount(s string) (Account, error) {
+	s = strings.TrimSpace(s)
+	user, rest, err := readName(s)
+	if err != nil {
+		return Account{}, err
+	}
+	if rest == "" {
+		return Account{User: user, Host: "%"}, nil
+	}
+	if rest[0] != '@' {
+		return Account{}, errors.New("无法解析账号:" + s)
+	}
+	host, rest, err := readName(rest[1:])
+	if err != nil {
+		return Account{}, err
+	}
+	if rest != "" {
+		return Account{}, errors.New("无法解析账号:" + s)
+	}
+	return Account{User: user, Host: host}, nil
+}
+
+//从字符串开头读取一个账号,返回账号和剩余的字符串
+func splitAccountPrefix(s string) (Account, string, error) {
+	s = strings.TrimLeft(s, " ")
+	user, rest, err := readName(s)
+	if err != nil {
+		return Account{}, "", err
+	}
+	if !strings.HasPrefix(rest, "@") {
+		return Account{}, "", errors.New("无法解析账号:" + s)
+	}
+	host, rest, err := readName(rest[1:])
+	if err != nil {
+		return Account{}, "", err
+	}
+	return Account{User: user, Host: host}, rest, nil
+}
+
+//将SHOW GRANTS中的一行授权语句的被授权账号替换为to
+func rewriteGrantee(line string, to Account) (string, error) {
+	kw := "TO"
+	if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(line)), "REVOKE ") {
+		kw = "FROM"
+	}
+	idx := indexKeyword(line, kw)
+	if idx < 0 {
+		return "", errors.New("无法匹配权限" + line)
+	}
+	_, rest, err := splitAccountPrefix(line[idx+len(kw):])
+	if err != nil {
+		return "", errors.Wrap(err, "无法匹配权限"+line)
+	}
+	return line[:idx+len(kw)] + " " + to.String() + rest, nil
+}
+
+//从字符串开头读取一个名称,可以用引号括起来,返回名称和剩余的字符串
+func readName(s string) (name, rest string, err error) {
+	if s == "" {
+		return "", "", nil
+	}
+	quote := s[0]
+	if quote != '`' && quote != '\'' && quote != '"' {
+		if i := strings.IndexByte(s, '@'); i >= 0 {
+			return s[:i], s[i:], nil
+		}
+		return s, "", nil
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && quote != '`' && i+1 < len(s):
+			i++
+			b.WriteByte(s[i])
+		case c == quote && i+1 < len(s) && s[i+1] == quote:
+			b.WriteByte(c)
+			i++
+		case c == quote:
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", errors.New("引号不匹配:" + s)
+}
+
+//在SQL文本中查找关键字,跳过引号和括号内的内容,找不到时返回-1
+//关键字前后必须是空白或者字符串的开头结尾
+func indexKeyword(s, kw string) int {
+	var (
+		quote byte
+		depth int
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				if i+1 < len(s) && s[i+1] == quote {
+					i++
+				} else {
+					quote = 0
+				}
+			}
+		case c == '`' || c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && (i == 0 || isSpace(s[i-1])) && len(s)-i >= len(kw) && strings.EqualFold(s[i:i+len(kw)], kw) &&
+			(i+len(kw) == len(s) || isSpace(s[i+len(kw)])):
+			return i
+		}
+	}
+	return -1
+}
+
+//按照分隔符拆分字符串,忽略引号和括号内的分隔符,并去掉每一部分前后的空白
+func splitTopLevel(s string, sep byte) []string {
+	var (
+		parts []string
+		quote byte
+		depth int
+		start int
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				if i+1 < len(s) && s[i+1] == quote {
+					i++
+				} else {
+					quote = 0
+				}
+			}
+		case c == '`' || c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" || len(parts) > 0 {
+		parts = append(parts, last)
+	}
+	return parts
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGrant(t *testing.T) {
+	cases := []struct {
+		line    string
+		want    Privilege
+		wantErr bool
+	}{
+		{
+			line: "GRANT USAGE ON *.* TO `u1`@`localhost`",
+			want: Privilege{Privileges: []string{"USAGE"}, Level: "*.*"},
+		},
+		{
+			line: "GRANT ALL PRIVILEGES ON *.* TO 'root'@'localhost' WITH GRANT OPTION",
+			want: Privilege{Privileges: []string{"ALL PRIVILEGES"}, Level: "*.*", GrantOption: true},
+		},
+		{
+			line: "GRANT SELECT, INSERT, UPDATE ON `db1`.* TO `app`@`10.%`",
+			want: Privilege{Privileges: []string{"SELECT", "INSERT", "UPDATE"}, Level: "`db1`.*"},
+		},
+		{
+			line: "GRANT SELECT (`id`, `name`), UPDATE (`name`) ON `db1`.`t1` TO `app`@`%`",
+			want: Privilege{Privileges: []string{"SELECT (`id`,`name`)", "UPDATE (`name`)"}, Level: "`db1`.`t1`"},
+		},
+		{
+			line: "GRANT EXECUTE ON PROCEDURE `db1`.`p1` TO `app`@`%`",
+			want: Privilege{Privileges: []string{"EXECUTE"}, ObjectType: "PROCEDURE", Level: "`db1`.`p1`"},
+		},
+		{
+			line: "GRANT BACKUP_ADMIN,BINLOG_ADMIN ON *.* TO `dba`@`%` WITH GRANT OPTION",
+			want: Privilege{Privileges: []string{"BACKUP_ADMIN", "BINLOG_ADMIN"}, Level: "*.*", GrantOption: true},
+		},
+		{
+			line: "GRANT `r1`@`%`,`r2`@`%` TO `u1`@`localhost`",
+			want: Privilege{Roles: []Account{{"r1", "%"}, {"r2", "%"}}},
+		},
+		{
+			line: "GRANT `app_rw`@`%` TO `u1`@`%` WITH ADMIN OPTION",
+			want: Privilege{Roles: []Account{{"app_rw", "%"}}, GrantOption: true},
+		},
+		{
+			line: "REVOKE INSERT ON `mysql`.* FROM `u1`@`%`",
+			want: Privilege{Privileges: []string{"INSERT"}, Level: "`mysql`.*", Revoked: true},
+		},
+		{
+			line: "GRANT PROXY ON ''@'' TO 'root'@'localhost' WITH GRANT OPTION",
+			want: Privilege{Privileges: []string{"PROXY"}, Level: "''@''", GrantOption: true},
+		},
+		{
+			line: "GRANT SELECT ON `a to b`.* TO `u1`@`%`",
+			want: Privilege{Privileges: []string{"SELECT"}, Level: "`a to b`.*"},
+		},
+		{line: "SHOW GRANTS", wantErr: true},
+		{line: "GRANT SELECT ON *.*", wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := parseGrant(c.line)
+		if (err != nil) != c.wantErr {
+			t.Errorf("parseGrant(%q) err=%v,wantErr %v", c.line, err, c.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		c.want.Grant = c.line
+		if !reflect.DeepEqual(*got, c.want) {
+			t.Errorf("parseGrant(%q)\n got:%+v\nwant:%+v", c.line, *got, c.want)
+		}
+	}
+}
+
+func TestParseAccount(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    Account
+		wantErr bool
+	}{
+		{"`u1`@`localhost`", Account{"u1", "localhost"}, false},
+		{"'u1'@'%'", Account{"u1", "%"}, false},
+		{"u1@10.0.0.1", Account{"u1", "10.0.0.1"}, false},
+		{"`r1`", Account{"r1", "%"}, false},
+		{"'o''brien'@'%'", Account{"o'brien", "%"}, false},
+		{"'u1'@'%", Account{}, true},
+		{"'u1'x", Account{}, true},
+	}
+	for _, c := range cases {
+		got, err := parseAccount(c.in)
+		if (err != nil) != c.wantErr {
+			t.Errorf("parseAccount(%q) err=%v,wantErr %v", c.in, err, c.wantErr)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("parseAccount(%q)=%+v,want %+v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestRewriteGrantee(t *testing.T) {
+	to := Account{User: "app2", Host: "%"}
+	cases := []struct {
+		line, want string
+	}{
+		{"GRANT USAGE ON *.* TO `u1`@`localhost`", "GRANT USAGE ON *.* TO 'app2'@'%'"},
+		{"GRANT ALL PRIVILEGES ON *.* TO 'root'@'%' WITH GRANT OPTION", "GRANT ALL PRIVILEGES ON *.* TO 'app2'@'%' WITH GRANT OPTION"},
+		{"GRANT `r1`@`%`,`r2`@`%` TO `u1`@`localhost`", "GRANT `r1`@`%`,`r2`@`%` TO 'app2'@'%'"},
+		{"GRANT SELECT ON `to`.* TO `u1`@`%`", "GRANT SELECT ON `to`.* TO 'app2'@'%'"},
+		{"REVOKE INSERT ON `mysql`.* FROM `u1`@`%`", "REVOKE INSERT ON `mysql`.* FROM 'app2'@'%'"},
+	}
+	for _, c := range cases {
+		got, err := rewriteGrantee(c.line, to)
+		if err != nil {
+			t.Errorf("rewriteGrantee(%q) err=%v", c.line, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("rewriteGrantee(%q)\n got:%s\nwant:%s", c.line, got, c.want)
+		}
+	}
+}
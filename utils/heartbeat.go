@@ -0,0 +1,206 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/pkg/errors"
+	"log"
+	"time"
+)
+
+//计算复制延迟的方式
+const (
+	LagMethodHeartbeat     = "heartbeat"      //通过心跳表计算
+	LagMethodReplicaStatus = "replica_status" //通过SHOW REPLICA STATUS中的Seconds_Behind_Source计算
+)
+
+//心跳表的选项,零值字段使用默认值
+//心跳表与pt-heartbeat的表结构兼容,ts保存主库的UTC时间,精确到微秒
+type HeartbeatOptions struct {
+	Schema   string        //默认为dbfree
+	Table    string        //默认为heartbeat
+	Interval time.Duration //RunHeartbeat写入心跳的间隔,默认为1秒,计算出的延迟最多比实际延迟大一个间隔
+	ServerId int           //ReplicationLag读取的主库server_id,为0时使用复制状态中的Source_Server_Id
+}
+
+//复制延迟
+type ReplicaLag struct {
+	Lag      time.Duration
+	Method   string //LagMethodHeartbeat或LagMethodReplicaStatus
+	ServerId int    //使用心跳表计算时对应的主库server_id
+}
+
+//将未设置的心跳选项填充为默认值
+func mergeHeartbeatOptions(opts []HeartbeatOptions) *HeartbeatOptions {
+	o := HeartbeatOptions{}
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.Schema == "" {
+		o.Schema = "dbfree"
+	}
+	if o.Table == "" {
+		o.Table = "heartbeat"
+	}
+	if o.Interval <= 0 {
+		o.Interval = time.Second
+	}
+	return &o
+}
+
+func (o *HeartbeatOptions) tableName() string {
+	return quoteIdentifier(o.Schema) + "." + quoteIdentifier(o.Table)
+}
+
+//在主库上创建心跳表,表已经存在时不做任何操作
+func (d *DBHandler) CreateHeartbeatTable(opts ...HeartbeatOptions) error {
+	return d.CreateHeartbeatTableContext(context.Background(), opts...)
+}
+
+//同CreateHeartbeatTable,ctx用于超时和取消控制
+func (d *DBHandler) CreateHeartbeatTableContext(ctx context.Context, opts ...HeartbeatOptions) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	o := mergeHeartbeatOptions(opts)
+	if _, err := d.conn.ExecContext(ctx, "CREATE DATABASE IF NOT EXISTS "+quoteIdentifier(o.Schema)); err != nil {
+		return err
+	}
+	createTableSQL := "CREATE TABLE IF NOT EXISTS " + o.tableName() + " (" +
+		"ts varchar(26) NOT NULL," +
+		"server_id int unsigned NOT NULL PRIMARY KEY," +
+		"file varchar(255) DEFAULT NULL," +
+		"position bigint unsigned DEFAULT NULL," +
+		"relay_master_log_file varchar(255) DEFAULT NULL," +
+		"exec_master_log_pos bigint unsigned DEFAULT NULL)"
+	_, err := d.conn.ExecContext(ctx, createTableSQL)
+	return err
+}
+
+//在主库上写入一次心跳,使用主库的UTC时间
+func (d *DBHandler) WriteHeartbeat(opts ...HeartbeatOptions) error {
+	return d.WriteHeartbeatContext(context.Background(), opts...)
+}
+
+//同WriteHeartbeat,ctx用于超时和取消控制
+func (d *DBHandler) WriteHeartbeatContext(ctx context.Context, opts ...HeartbeatOptions) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	o := mergeHeartbeatOptions(opts)
+	//binlog_format为STATEMENT或MIXED时@@server_id会在从库上重新求值,需要先读出主库的server_id再作为参数写入
+	var serverId uint32
+	if err := d.conn.QueryRowContext(ctx, "SELECT @@server_id").Scan(&serverId); err != nil {
+		return err
+	}
+	writeHeartbeatSQL := "REPLACE INTO " + o.tableName() + " (ts,server_id) " +
+		"VALUES (DATE_FORMAT(UTC_TIMESTAMP(6),'%Y-%m-%dT%H:%i:%s.%f'),?)"
+	_, err := d.conn.ExecContext(ctx, writeHeartbeatSQL, serverId)
+	return err
+}
+
+//按照opts.Interval在主库上持续写入心跳,直到ctx被取消,表不存在时自动创建
+//写入失败时记录日志并继续,返回值为ctx.Err()
+func (d *DBHandler) RunHeartbeat(ctx context.Context, opts ...HeartbeatOptions) error {
+	o := mergeHeartbeatOptions(opts)
+	if err := d.CreateHeartbeatTableContext(ctx, *o); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(o.Interval)
+	defer ticker.Stop()
+	for {
+		if err := d.WriteHeartbeatContext(ctx, *o); err != nil && ctx.Err() == nil {
+			log.Printf("写入心跳表%s失败:%v", o.tableName(), err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+//根据心跳表计算从库相对于serverId的主库的延迟,使用从库的UTC时间
+//主从之间的时钟误差会影响结果,结果小于0时为0
+func (d *DBHandler) HeartbeatLag(serverId int, opts ...HeartbeatOptions) (time.Duration, error) {
+	return d.HeartbeatLagContext(context.Background(), serverId, opts...)
+}
+
+//同HeartbeatLag,ctx用于超时和取消控制
+func (d *DBHandler) HeartbeatLagContext(ctx context.Context, serverId int, opts ...HeartbeatOptions) (time.Duration, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	o := mergeHeartbeatOptions(opts)
+	var micros sql.NullInt64
+	heartbeatLagSQL := "SELECT TIMESTAMPDIFF(MICROSECOND,ts,UTC_TIMESTAMP(6)) FROM " + o.tableName() + " WHERE server_id=?"
+	if err := d.conn.QueryRowContext(ctx, heartbeatLagSQL, serverId).Scan(&micros); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, errors.New(fmt.Sprintf("心跳表%s中没有server_id为%d的心跳", o.tableName(), serverId))
+		}
+		return 0, err
+	}
+	if !micros.Valid {
+		return 0, errors.New(fmt.Sprintf("心跳表%s中server_id为%d的时间格式不正确", o.tableName(), serverId))
+	}
+	if micros.Int64 < 0 {
+		return 0, nil
+	}
+	return time.Duration(micros.Int64) * time.Microsecond, nil
+}
+
+//查看从库的复制延迟,多个复制通道时返回最大的延迟
+//优先使用心跳表计算,心跳表不存在或者没有对应主库的心跳时使用SHOW REPLICA STATUS中的Seconds_Behind_Source
+func (d *DBHandler) ReplicationLag(opts ...HeartbeatOptions) (*ReplicaLag, error) {
+	return d.ReplicationLagContext(context.Background(), opts...)
+}
+
+//同ReplicationLag,ctx用于超时和取消控制
+func (d *DBHandler) ReplicationLagContext(ctx context.Context, opts ...HeartbeatOptions) (*ReplicaLag, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	o := mergeHeartbeatOptions(opts)
+	statusList, err := d.ShowReplicaStatusContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	serverIds := make([]int, 0, len(statusList))
+	if o.ServerId != 0 {
+		serverIds = append(serverIds, o.ServerId)
+	} else {
+		for _, s := range statusList {
+			if s.SourceServerId != 0 {
+				serverIds = append(serverIds, s.SourceServerId)
+			}
+		}
+	}
+	var heartbeatLag *ReplicaLag
+	for _, serverId := range serverIds {
+		lag, err := d.HeartbeatLagContext(ctx, serverId, *o)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			//心跳表不存在或者缺少某个主库的心跳时整体使用复制状态
+			heartbeatLag = nil
+			break
+		}
+		if heartbeatLag == nil || lag > heartbeatLag.Lag {
+			heartbeatLag = &ReplicaLag{Lag: lag, Method: LagMethodHeartbeat, ServerId: serverId}
+		}
+	}
+	if heartbeatLag != nil {
+		return heartbeatLag, nil
+	}
+	if len(statusList) == 0 {
+		return nil, errors.New("当前实例不是从库")
+	}
+	lag := &ReplicaLag{Method: LagMethodReplicaStatus}
+	for _, s := range statusList {
+		if s.SecondsBehind < 0 {
+			return nil, errors.New(fmt.Sprintf("复制通道%s的延迟未知,IO线程:%s,SQL线程:%s", quoteLiteral(s.Channel), s.IORunning, s.SQLRunning))
+		}
+		if behind := time.Duration(s.SecondsBehind) * time.Second; behind > lag.Lag {
+			lag.Lag = behind
+		}
+	}
+	return lag, nil
+}
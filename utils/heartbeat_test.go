@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMergeHeartbeatOptions(t *testing.T) {
+	o := mergeHeartbeatOptions(nil)
+	if o.Schema != "dbfree" || o.Table != "heartbeat" || o.Interval != time.Second || o.tableName() != "`dbfree`.`heartbeat`" {
+		t.Errorf("unexpected default options:%+v", o)
+	}
+	o = mergeHeartbeatOptions([]HeartbeatOptions{{Schema: "percona", Interval: 100 * time.Millisecond, ServerId: 3}})
+	if o.tableName() != "`percona`.`heartbeat`" || o.Interval != 100*time.Millisecond || o.ServerId != 3 {
+		t.Errorf("unexpected merged options:%+v", o)
+	}
+}
@@ -26,6 +26,14 @@ func caller(i int) string {
 	}
 }
 
+//将~开头的路径展开为指定用户的home目录
+func expandHomeDir(path, homeDir string) string {
+	if strings.HasPrefix(path, "~") {
+		return filepath.Join(homeDir, path[1:])
+	}
+	return path
+}
+
 type MySQLInstance struct {
 	//UserName string
 	User          user.User
@@ -254,10 +262,7 @@ func getMySQLInstances() ([]*MySQLInstance, error) {
 					numField := strings.Fields(eachLine)
 					for _, v := range numField {
 						//如果是~开头，那么是启动用户的home目录
-						if strings.HasPrefix(v, "~") {
-							v = filepath.Join(inst.User.HomeDir, v[1:])
-						}
-						inst.MycnfPathList = append(inst.MycnfPathList, v)
+						inst.MycnfPathList = append(inst.MycnfPathList, expandHomeDir(v, inst.User.HomeDir))
 					}
 					isMycnfPathList = false
 					break
@@ -275,3 +280,37 @@ func getMySQLInstances() ([]*MySQLInstance, error) {
 	}
 	return mysqlInstances, nil
 }
+
+//连接本地实例,优先使用unix socket,socket不可用时使用127.0.0.1上的TCP端口
+//auth_socket插件或者只允许localhost登录的账号只能通过socket连接
+func (inst *MySQLInstance) Connect(user, password string, opts ...ConnOptions) (*DBHandler, error) {
+	var socketErr error
+	if inst.NetStat.SocketFile != "" {
+		dbHandler, err := NewDBHandler(inst.NetStat.SocketFile, 0, user, password, opts...)
+		if err == nil {
+			if err = dbHandler.ping(); err == nil {
+				return dbHandler, nil
+			}
+			dbHandler.Close()
+		}
+		socketErr = err
+	}
+	if inst.NetStat.Port == 0 {
+		if socketErr != nil {
+			return nil, errors.Wrap(socketErr, fmt.Sprintf("实例%d通过socket:%s连接失败且没有监听端口", inst.PID, inst.NetStat.SocketFile))
+		}
+		return nil, errors.New(fmt.Sprintf("实例%d没有可用的socket文件和监听端口", inst.PID))
+	}
+	dbHandler, err := NewDBHandler("127.0.0.1", inst.NetStat.Port, user, password, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := dbHandler.ping(); err != nil {
+		dbHandler.Close()
+		if socketErr != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("通过socket连接失败:%s,通过端口%d连接失败", socketErr, inst.NetStat.Port))
+		}
+		return nil, err
+	}
+	return dbHandler, nil
+}
@@ -0,0 +1,263 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//MySQL 8.0.22开始使用SHOW REPLICA STATUS、START REPLICA等新语法,列名中的Master/Slave改为Source/Replica
+var replicaSyntaxVersion = [3]int{8, 0, 22}
+
+//SHOW REPLICA STATUS中Last_IO_Error_Timestamp等时间字段的格式
+const replicaTimestampLayout = "060102 15:04:05"
+
+//从库某个复制通道的状态,对应SHOW REPLICA STATUS中的一行,多源复制时每个通道一行
+type ReplicaStatus struct {
+	Channel        string //通道名称,默认通道为空
+	SourceHost     string
+	SourcePort     int
+	SourceUser     string
+	SourceServerId int
+	SourceUUID     string
+	ConnectRetry   int
+
+	IOState           string //IO线程状态,对应Replica_IO_State
+	IORunning         string //Yes,No或Connecting
+	SQLRunning        string //Yes或No
+	SQLRunningState   string //SQL线程状态,对应Replica_SQL_Running_State
+	SecondsBehind     int64  //对应Seconds_Behind_Source,SQL线程没有运行等情况下为NULL,此时为-1
+	SQLDelay          int    //延迟复制的秒数
+	SQLRemainingDelay int    //延迟复制剩余的秒数,没有等待时为-1
+
+	SourceLogFile      string //IO线程读取到的主库binlog文件
+	ReadSourceLogPos   uint64 //IO线程读取到的主库binlog位置
+	RelayLogFile       string //SQL线程执行到的relay log文件
+	RelayLogPos        uint64 //SQL线程执行到的relay log位置
+	RelaySourceLogFile string //SQL线程执行到的事务对应的主库binlog文件
+	ExecSourceLogPos   uint64 //SQL线程执行到的事务对应的主库binlog位置
+
+	AutoPosition     bool   //是否使用GTID自动定位
+	RetrievedGtidSet string //IO线程接收到的GTID集合
+	ExecutedGtidSet  string //从库已经执行的GTID集合
+
+	LastIOErrno      int
+	LastIOError      string
+	LastIOErrorTime  time.Time //没有错误时为零值
+	LastSQLErrno     int
+	LastSQLError     string
+	LastSQLErrorTime time.Time //没有错误时为零值
+
+	Raw map[string]string //原始的列名和值,列名统一转换成Source/Replica形式
+}
+
+//IO线程是否正在运行
+func (r *ReplicaStatus) IOThreadRunning() bool {
+	return r.IORunning == "Yes"
+}
+
+//SQL线程是否正在运行
+func (r *ReplicaStatus) SQLThreadRunning() bool {
+	return r.SQLRunning == "Yes"
+}
+
+//IO线程和SQL线程都在运行并且都没有错误
+func (r *ReplicaStatus) Healthy() bool {
+	return r.IOThreadRunning() && r.SQLThreadRunning() && r.LastIOErrno == 0 && r.LastSQLErrno == 0
+}
+
+//根据版本选择查看复制状态的语句
+func showReplicaStatusSQL(version [3]int) string {
+	if versionAtLeast(version, replicaSyntaxVersion) {
+		return "SHOW REPLICA STATUS"
+	}
+	return "SHOW SLAVE STATUS"
+}
+
+//将旧版本的列名统一转换成8.0.22之后的列名,如Seconds_Behind_Master转换为Seconds_Behind_Source
+func normalizeReplicaColumn(name string) string {
+	name = strings.Replace(name, "Master", "Source", -1)
+	return strings.Replace(name, "Slave", "Replica", -1)
+}
+
+//将8.0.22之后的列名转换回SHOW SLAVE STATUS的列名,如Replica_IO_Running转换为Slave_IO_Running
+//按下划线分隔后只替换完整的Replica和Source,Replicate_Do_DB等列名不变
+//Get_Source_public_key对应的旧列名中master为小写
+func legacyReplicaColumn(name string) string {
+	if name == "Get_Source_public_key" {
+		return "Get_master_public_key"
+	}
+	tokens := strings.Split(name, "_")
+	for i, token := range tokens {
+		switch token {
+		case "Replica":
+			tokens[i] = "Slave"
+		case "Source":
+			tokens[i] = "Master"
+		}
+	}
+	return strings.Join(tokens, "_")
+}
+
+//查看所有复制通道的状态,不是从库时返回空列表
+//MySQL 8.0.22及以上版本使用SHOW REPLICA STATUS,否则使用SHOW SLAVE STATUS
+func (d *DBHandler) ShowReplicaStatus() ([]*ReplicaStatus, error) {
+	return d.ShowReplicaStatusContext(context.Background())
+}
+
+//同ShowReplicaStatus,ctx用于超时和取消控制
+func (d *DBHandler) ShowReplicaStatusContext(ctx context.Context) ([]*ReplicaStatus, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	version, err := d.GetVersionContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rowMaps, err := d.queryStringMaps(ctx, showReplicaStatusSQL(version))
+	if err != nil {
+		return nil, err
+	}
+	statusList := make([]*ReplicaStatus, 0, len(rowMaps))
+	for _, rowMap := range rowMaps {
+		status, err := parseReplicaStatus(rowMap)
+		if err != nil {
+			return nil, err
+		}
+		statusList = append(statusList, status)
+	}
+	return statusList, nil
+}
+
+//查看指定复制通道的状态,通道不存在时返回错误
+func (d *DBHandler) ShowReplicaChannelStatus(channel string) (*ReplicaStatus, error) {
+	return d.ShowReplicaChannelStatusContext(context.Background(), channel)
+}
+
+//同ShowReplicaChannelStatus,ctx用于超时和取消控制
+func (d *DBHandler) ShowReplicaChannelStatusContext(ctx context.Context, channel string) (*ReplicaStatus, error) {
+	statusList, err := d.ShowReplicaStatusContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range statusList {
+		if strings.EqualFold(status.Channel, channel) {
+			return status, nil
+		}
+	}
+	return nil, errors.New("复制通道不存在:" + channel)
+}
+
+//执行查询并将每一行转换成列名到值的map,NULL转换为空字符串
+func (d *DBHandler) queryStringMaps(ctx context.Context, query string) ([]map[string]string, error) {
+	rows, err := d.conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	colNames, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	colValues := make([]sql.NullString, len(colNames))
+	colValuesPtr := make([]interface{}, len(colNames))
+	for i := range colValues {
+		colValuesPtr[i] = &colValues[i]
+	}
+	rowMaps := make([]map[string]string, 0)
+	for rows.Next() {
+		if err := rows.Scan(colValuesPtr...); err != nil {
+			return nil, err
+		}
+		rowMap := make(map[string]string, len(colNames))
+		for i, v := range colValues {
+			rowMap[colNames[i]] = v.String
+		}
+		rowMaps = append(rowMaps, rowMap)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return rowMaps, nil
+}
+
+//将SHOW SLAVE STATUS或SHOW REPLICA STATUS的一行解析成ReplicaStatus
+func parseReplicaStatus(rowMap map[string]string) (*ReplicaStatus, error) {
+	raw := make(map[string]string, len(rowMap))
+	for k, v := range rowMap {
+		raw[normalizeReplicaColumn(k)] = v
+	}
+	var (
+		err    error
+		status = &ReplicaStatus{Raw: raw}
+	)
+	//依次解析各个字段,遇到第一个错误后不再解析
+	parseInt := func(col string, dst *int, nullValue int) {
+		if err != nil {
+			return
+		}
+		v := strings.TrimSpace(raw[col])
+		if v == "" {
+			*dst = nullValue
+			return
+		}
+		if *dst, err = strconv.Atoi(v); err != nil {
+			err = errors.Wrap(err, "无法解析"+col)
+		}
+	}
+	parseUint := func(col string, dst *uint64) {
+		if err != nil || strings.TrimSpace(raw[col]) == "" {
+			return
+		}
+		if *dst, err = strconv.ParseUint(strings.TrimSpace(raw[col]), 10, 64); err != nil {
+			err = errors.Wrap(err, "无法解析"+col)
+		}
+	}
+	parseTime := func(col string, dst *time.Time) {
+		if err != nil || strings.TrimSpace(raw[col]) == "" {
+			return
+		}
+		if *dst, err = time.ParseInLocation(replicaTimestampLayout, strings.TrimSpace(raw[col]), time.Local); err != nil {
+			err = errors.Wrap(err, "无法解析"+col)
+		}
+	}
+	status.Channel = raw["Channel_Name"]
+	status.SourceHost = raw["Source_Host"]
+	status.SourceUser = raw["Source_User"]
+	status.SourceUUID = raw["Source_UUID"]
+	status.IOState = raw["Replica_IO_State"]
+	status.IORunning = raw["Replica_IO_Running"]
+	status.SQLRunning = raw["Replica_SQL_Running"]
+	status.SQLRunningState = raw["Replica_SQL_Running_State"]
+	status.SourceLogFile = raw["Source_Log_File"]
+	status.RelayLogFile = raw["Relay_Log_File"]
+	status.RelaySourceLogFile = raw["Relay_Source_Log_File"]
+	status.AutoPosition = raw["Auto_Position"] == "1"
+	//GTID集合较长时服务端会插入换行
+	status.RetrievedGtidSet = strings.Replace(raw["Retrieved_Gtid_Set"], "\n", "", -1)
+	status.ExecutedGtidSet = strings.Replace(raw["Executed_Gtid_Set"], "\n", "", -1)
+	status.LastIOError = raw["Last_IO_Error"]
+	status.LastSQLError = raw["Last_SQL_Error"]
+
+	var secondsBehind int
+	parseInt("Source_Port", &status.SourcePort, 0)
+	parseInt("Source_Server_Id", &status.SourceServerId, 0)
+	parseInt("Connect_Retry", &status.ConnectRetry, 0)
+	parseInt("Seconds_Behind_Source", &secondsBehind, -1)
+	parseInt("SQL_Delay", &status.SQLDelay, 0)
+	parseInt("SQL_Remaining_Delay", &status.SQLRemainingDelay, -1)
+	parseInt("Last_IO_Errno", &status.LastIOErrno, 0)
+	parseInt("Last_SQL_Errno", &status.LastSQLErrno, 0)
+	parseUint("Read_Source_Log_Pos", &status.ReadSourceLogPos)
+	parseUint("Relay_Log_Pos", &status.RelayLogPos)
+	parseUint("Exec_Source_Log_Pos", &status.ExecSourceLogPos)
+	parseTime("Last_IO_Error_Timestamp", &status.LastIOErrorTime)
+	parseTime("Last_SQL_Error_Timestamp", &status.LastSQLErrorTime)
+	if err != nil {
+		return nil, err
+	}
+	status.SecondsBehind = int64(secondsBehind)
+	return status, nil
+}
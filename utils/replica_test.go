@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseReplicaStatus(t *testing.T) {
+	//5.7的列名
+	old := map[string]string{
+		"Channel_Name":             "ch1",
+		"Master_Host":              "10.0.0.1",
+		"Master_Port":              "3306",
+		"Slave_IO_Running":         "Yes",
+		"Slave_SQL_Running":        "No",
+		"Seconds_Behind_Master":    "",
+		"Read_Master_Log_Pos":      "1234",
+		"Exec_Master_Log_Pos":      "1000",
+		"Relay_Master_Log_File":    "mysql-bin.000003",
+		"Executed_Gtid_Set":        "3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5,\n4E11FA47-71CA-11E1-9E33-C80AA9429562:1",
+		"Auto_Position":            "1",
+		"Last_SQL_Errno":           "1062",
+		"Last_SQL_Error_Timestamp": "230105 09:38:31",
+		"SQL_Remaining_Delay":      "",
+	}
+	s, err := parseReplicaStatus(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Channel != "ch1" || s.SourceHost != "10.0.0.1" || s.SourcePort != 3306 || !s.IOThreadRunning() || s.SQLThreadRunning() {
+		t.Errorf("unexpected status:%+v", s)
+	}
+	if s.SecondsBehind != -1 || s.SQLRemainingDelay != -1 || s.ReadSourceLogPos != 1234 || s.ExecSourceLogPos != 1000 || s.RelaySourceLogFile != "mysql-bin.000003" {
+		t.Errorf("unexpected positions:%+v", s)
+	}
+	if s.ExecutedGtidSet != "3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5,4E11FA47-71CA-11E1-9E33-C80AA9429562:1" || !s.AutoPosition {
+		t.Errorf("unexpected gtid:%+v", s)
+	}
+	if s.Healthy() || s.LastSQLErrno != 1062 || !s.LastSQLErrorTime.Equal(time.Date(2023, 1, 5, 9, 38, 31, 0, time.Local)) {
+		t.Errorf("unexpected errors:%+v", s)
+	}
+
+	//8.0.22之后的列名
+	s, err = parseReplicaStatus(map[string]string{"Source_Host": "h", "Replica_IO_Running": "Yes", "Replica_SQL_Running": "Yes", "Seconds_Behind_Source": "7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.SourceHost != "h" || !s.Healthy() || s.SecondsBehind != 7 {
+		t.Errorf("unexpected status:%+v", s)
+	}
+
+	if _, err := parseReplicaStatus(map[string]string{"Master_Port": "x"}); err == nil {
+		t.Errorf("invalid port should fail")
+	}
+}
+
+func TestShowReplicaStatusSQL(t *testing.T) {
+	if got := showReplicaStatusSQL([3]int{5, 7, 40}); got != "SHOW SLAVE STATUS" {
+		t.Errorf("got %s", got)
+	}
+	if got := showReplicaStatusSQL([3]int{8, 0, 22}); got != "SHOW REPLICA STATUS" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestLegacyReplicaColumn(t *testing.T) {
+	cases := map[string]string{
+		"Replica_IO_Running":          "Slave_IO_Running",
+		"Source_Host":                 "Master_Host",
+		"Seconds_Behind_Source":       "Seconds_Behind_Master",
+		"Relay_Source_Log_File":       "Relay_Master_Log_File",
+		"Get_Source_public_key":       "Get_master_public_key",
+		"Executed_Gtid_Set":           "Executed_Gtid_Set",
+		"Replica_SQL_Running_State":   "Slave_SQL_Running_State",
+		"Replicate_Do_DB":             "Replicate_Do_DB",
+		"Replicate_Ignore_DB":         "Replicate_Ignore_DB",
+		"Replicate_Wild_Do_Table":     "Replicate_Wild_Do_Table",
+		"Replicate_Wild_Ignore_Table": "Replicate_Wild_Ignore_Table",
+		"Replicate_Ignore_Server_Ids": "Replicate_Ignore_Server_Ids",
+		"Replicate_Rewrite_DB":        "Replicate_Rewrite_DB",
+	}
+	for name, want := range cases {
+		if got := legacyReplicaColumn(name); got != want {
+			t.Errorf("legacyReplicaColumn(%s)=%s,want %s", name, got, want)
+		}
+	}
+}
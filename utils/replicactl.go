@@ -0,0 +1,323 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"regexp"
+	"strings"
+)
+
+//MySQL 8.0.23开始使用CHANGE REPLICATION SOURCE TO替代CHANGE MASTER TO
+var changeSourceVersion = [3]int{8, 0, 23}
+
+//MySQL 8.0.26开始使用sql_replica_skip_counter替代sql_slave_skip_counter
+var replicaSkipCounterVersion = [3]int{8, 0, 26}
+
+//MySQL 8.0.2开始replication_applier_status_by_worker使用APPLYING_TRANSACTION记录正在执行的事务
+var applyingTransactionVersion = [3]int{8, 0, 2}
+
+//启动或停止复制时指定的线程,为空时表示IO线程和SQL线程
+const (
+	ReplicaIOThread  = "IO_THREAD"
+	ReplicaSQLThread = "SQL_THREAD"
+)
+
+//配置从库复制的选项,用于ConfigureReplica
+type ReplicaConfig struct {
+	SourceHost string
+	SourcePort int //为0时为3306
+	User       string
+	Password   string
+	Channel    string //复制通道,为空时为默认通道
+
+	//复制的起始位置,AutoPosition和LogFile、LogPos只能指定一种
+	AutoPosition bool   //使用GTID自动定位,主从都需要开启gtid_mode
+	LogFile      string //主库binlog文件名
+	LogPos       uint64 //主库binlog位置
+
+	ConnectRetry int //重连间隔秒数,0表示使用默认值
+
+	//SSL选项,SSL为false时忽略其他SSL选项
+	SSL     bool
+	SSLCA   string //CA证书路径,为主从库所在主机上的路径
+	SSLCert string
+	SSLKey  string
+	//不使用SSL时请求主库的RSA公钥,复制用户使用caching_sha2_password时需要,只在8.0中支持
+	GetSourcePublicKey bool
+}
+
+//生成FOR CHANNEL子句,channel为空时返回空字符串
+func channelClause(channel string) string {
+	if channel == "" {
+		return ""
+	}
+	return " FOR CHANNEL " + quoteLiteral(channel)
+}
+
+//根据版本返回复制语句中的关键字,8.0.22之前为SLAVE,之后为REPLICA
+func replicaKeyword(version [3]int) string {
+	if versionAtLeast(version, replicaSyntaxVersion) {
+		return "REPLICA"
+	}
+	return "SLAVE"
+}
+
+//根据ReplicaConfig生成CHANGE MASTER TO或CHANGE REPLICATION SOURCE TO语句
+func buildChangeSourceSQL(cfg *ReplicaConfig, version [3]int) (string, error) {
+	if cfg.SourceHost == "" {
+		return "", errors.New("主库地址不能为空")
+	}
+	if cfg.User == "" {
+		return "", errors.New("复制用户不能为空")
+	}
+	if cfg.AutoPosition && cfg.LogFile != "" {
+		return "", errors.New("AutoPosition和LogFile只能指定一种")
+	}
+	if !cfg.AutoPosition && cfg.LogFile == "" {
+		return "", errors.New("需要指定AutoPosition或者LogFile和LogPos")
+	}
+	if cfg.GetSourcePublicKey && version[0] < 8 {
+		return "", errors.New(fmt.Sprintf("GetSourcePublicKey需要MySQL 8.0及以上版本,当前版本:%v", version))
+	}
+	stmt, prefix, publicKeyOption := "CHANGE MASTER TO", "MASTER_", "GET_MASTER_PUBLIC_KEY"
+	if versionAtLeast(version, changeSourceVersion) {
+		stmt, prefix, publicKeyOption = "CHANGE REPLICATION SOURCE TO", "SOURCE_", "GET_SOURCE_PUBLIC_KEY"
+	}
+	port := cfg.SourcePort
+	if port == 0 {
+		port = 3306
+	}
+	options := []string{
+		fmt.Sprintf("%sHOST=%s", prefix, quoteLiteral(cfg.SourceHost)),
+		fmt.Sprintf("%sPORT=%d", prefix, port),
+		fmt.Sprintf("%sUSER=%s", prefix, quoteLiteral(cfg.User)),
+		fmt.Sprintf("%sPASSWORD=%s", prefix, quoteLiteral(cfg.Password)),
+	}
+	if cfg.AutoPosition {
+		options = append(options, prefix+"AUTO_POSITION=1")
+	} else {
+		options = append(options,
+			prefix+"AUTO_POSITION=0",
+			fmt.Sprintf("%sLOG_FILE=%s", prefix, quoteLiteral(cfg.LogFile)),
+			fmt.Sprintf("%sLOG_POS=%d", prefix, cfg.LogPos))
+	}
+	if cfg.ConnectRetry > 0 {
+		options = append(options, fmt.Sprintf("%sCONNECT_RETRY=%d", prefix, cfg.ConnectRetry))
+	}
+	if cfg.SSL {
+		options = append(options, prefix+"SSL=1")
+		for _, o := range []struct{ name, value string }{
+			{"SSL_CA", cfg.SSLCA}, {"SSL_CERT", cfg.SSLCert}, {"SSL_KEY", cfg.SSLKey},
+		} {
+			if o.value != "" {
+				options = append(options, fmt.Sprintf("%s%s=%s", prefix, o.name, quoteLiteral(o.value)))
+			}
+		}
+	} else {
+		options = append(options, prefix+"SSL=0")
+	}
+	if cfg.GetSourcePublicKey {
+		options = append(options, publicKeyOption+"=1")
+	}
+	return stmt + " " + strings.Join(options, ",") + channelClause(cfg.Channel), nil
+}
+
+//生成START/STOP SLAVE或START/STOP REPLICA语句,thread为空时同时作用于IO线程和SQL线程
+func buildReplicaThreadSQL(verb, thread, channel string, version [3]int) (string, error) {
+	switch thread {
+	case "", ReplicaIOThread, ReplicaSQLThread:
+	default:
+		return "", errors.New("不支持的复制线程:" + thread)
+	}
+	replicaThreadSQL := verb + " " + replicaKeyword(version)
+	if thread != "" {
+		replicaThreadSQL += " " + thread
+	}
+	return replicaThreadSQL + channelClause(channel), nil
+}
+
+//配置当前实例为cfg.SourceHost的从库,需要先停止复制线程
+//配置完成后不会自动启动复制,需要调用StartReplica
+func (d *DBHandler) ConfigureReplica(cfg *ReplicaConfig) error {
+	return d.ConfigureReplicaContext(context.Background(), cfg)
+}
+
+//同ConfigureReplica,ctx用于超时和取消控制
+func (d *DBHandler) ConfigureReplicaContext(ctx context.Context, cfg *ReplicaConfig) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	version, err := d.GetVersionContext(ctx)
+	if err != nil {
+		return err
+	}
+	changeSourceSQL, err := buildChangeSourceSQL(cfg, version)
+	if err != nil {
+		return err
+	}
+	_, err = d.conn.ExecContext(ctx, changeSourceSQL)
+	return err
+}
+
+//启动复制,thread为ReplicaIOThread或ReplicaSQLThread时只启动对应的线程,为空时都启动
+//channel为空时作用于所有复制通道
+func (d *DBHandler) StartReplica(channel, thread string) error {
+	return d.StartReplicaContext(context.Background(), channel, thread)
+}
+
+//同StartReplica,ctx用于超时和取消控制
+func (d *DBHandler) StartReplicaContext(ctx context.Context, channel, thread string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	return d.execReplicaThreadSQL(ctx, "START", channel, thread)
+}
+
+//停止复制,thread为ReplicaIOThread或ReplicaSQLThread时只停止对应的线程,为空时都停止
+//channel为空时作用于所有复制通道
+func (d *DBHandler) StopReplica(channel, thread string) error {
+	return d.StopReplicaContext(context.Background(), channel, thread)
+}
+
+//同StopReplica,ctx用于超时和取消控制
+func (d *DBHandler) StopReplicaContext(ctx context.Context, channel, thread string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	return d.execReplicaThreadSQL(ctx, "STOP", channel, thread)
+}
+
+func (d *DBHandler) execReplicaThreadSQL(ctx context.Context, verb, channel, thread string) error {
+	version, err := d.GetVersionContext(ctx)
+	if err != nil {
+		return err
+	}
+	replicaThreadSQL, err := buildReplicaThreadSQL(verb, thread, channel, version)
+	if err != nil {
+		return err
+	}
+	_, err = d.conn.ExecContext(ctx, replicaThreadSQL)
+	return err
+}
+
+//清除从库的复制信息和relay log,需要先停止复制
+//all为false时保留主库的连接信息,为true时同时删除复制通道的所有配置
+func (d *DBHandler) ResetReplica(channel string, all bool) error {
+	return d.ResetReplicaContext(context.Background(), channel, all)
+}
+
+//同ResetReplica,ctx用于超时和取消控制
+func (d *DBHandler) ResetReplicaContext(ctx context.Context, channel string, all bool) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	version, err := d.GetVersionContext(ctx)
+	if err != nil {
+		return err
+	}
+	resetReplicaSQL := "RESET " + replicaKeyword(version)
+	if all {
+		resetReplicaSQL += " ALL"
+	}
+	_, err = d.conn.ExecContext(ctx, resetReplicaSQL+channelClause(channel))
+	return err
+}
+
+//从SQL线程的报错信息中查找执行失败的GTID,如:Worker 1 failed executing transaction 'uuid:23' at ...
+var failedGtidPattern = regexp.MustCompile(`(?i)transaction '([0-9a-f-]{36}:[0-9]+)'`)
+
+//从performance_schema中查找复制通道执行失败的事务,单线程复制的报错信息中不包含GTID
+func (d *DBHandler) failedTransaction(ctx context.Context, channel string, version [3]int) (string, error) {
+	column := "LAST_SEEN_TRANSACTION"
+	if versionAtLeast(version, applyingTransactionVersion) {
+		column = "APPLYING_TRANSACTION"
+	}
+	rows, err := d.conn.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM performance_schema.replication_applier_status_by_worker "+
+		"WHERE CHANNEL_NAME=? AND LAST_ERROR_NUMBER<>0", column), channel)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var transactions []string
+	for rows.Next() {
+		var transaction string
+		if err := rows.Scan(&transaction); err != nil {
+			return "", err
+		}
+		if transaction != "" && transaction != "ANONYMOUS" {
+			transactions = append(transactions, transaction)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(transactions) != 1 {
+		return "", errors.New(fmt.Sprintf("无法确定复制通道%s执行失败的事务:%v", quoteLiteral(channel), transactions))
+	}
+	return transactions[0], nil
+}
+
+//跳过从库SQL线程执行失败的事务,然后重新启动SQL线程,SQL线程必须因为执行报错已经停止
+//开启gtid_mode时通过注入空事务跳过,返回跳过的GTID;否则通过sql_slave_skip_counter跳过一个事务,返回空字符串
+func (d *DBHandler) SkipTransaction(channel string) (string, error) {
+	return d.SkipTransactionContext(context.Background(), channel)
+}
+
+//同SkipTransaction,ctx用于超时和取消控制
+func (d *DBHandler) SkipTransactionContext(ctx context.Context, channel string) (string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	version, err := d.GetVersionContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	status, err := d.ShowReplicaChannelStatusContext(ctx, channel)
+	if err != nil {
+		return "", err
+	}
+	if status.SQLThreadRunning() {
+		return "", errors.New(fmt.Sprintf("复制通道%s的SQL线程正在运行,需要先停止SQL线程", quoteLiteral(channel)))
+	}
+	//SQL线程没有报错时跳过的是下一个正常的事务
+	if status.LastSQLErrno == 0 {
+		return "", errors.New(fmt.Sprintf("复制通道%s的SQL线程没有报错,没有需要跳过的事务", quoteLiteral(channel)))
+	}
+	var gtidMode string
+	if err := d.conn.QueryRowContext(ctx, "SELECT @@GLOBAL.gtid_mode").Scan(&gtidMode); err != nil {
+		return "", err
+	}
+	if gtidMode != "ON" {
+		skipCounter := "sql_slave_skip_counter"
+		if versionAtLeast(version, replicaSkipCounterVersion) {
+			skipCounter = "sql_replica_skip_counter"
+		}
+		if _, err := d.conn.ExecContext(ctx, fmt.Sprintf("SET GLOBAL %s = 1", skipCounter)); err != nil {
+			return "", err
+		}
+		return "", d.execReplicaThreadSQL(ctx, "START", channel, ReplicaSQLThread)
+	}
+	//优先使用报错信息中的GTID,否则从performance_schema中查找执行失败的事务
+	var skipped string
+	if m := failedGtidPattern.FindStringSubmatch(status.LastSQLError); m != nil {
+		skipped = m[1]
+	} else if skipped, err = d.failedTransaction(ctx, channel, version); err != nil {
+		return "", err
+	}
+	//GTID_NEXT是会话变量,需要在同一个连接上执行
+	conn, err := d.conn.Conn(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	for _, skipSQL := range []string{
+		fmt.Sprintf("SET GTID_NEXT=%s", quoteLiteral(skipped)),
+		"BEGIN",
+		"COMMIT",
+		"SET GTID_NEXT='AUTOMATIC'",
+	} {
+		if _, err := conn.ExecContext(ctx, skipSQL); err != nil {
+			//连接会放回连接池,需要恢复GTID_NEXT
+			conn.ExecContext(context.Background(), "ROLLBACK")
+			conn.ExecContext(context.Background(), "SET GTID_NEXT='AUTOMATIC'")
+			return "", errors.Wrap(err, skipSQL)
+		}
+	}
+	return skipped, d.execReplicaThreadSQL(ctx, "START", channel, ReplicaSQLThread)
+}
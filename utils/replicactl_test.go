@@ -0,0 +1,62 @@
+package utils
+
+import "testing"
+
+func TestBuildChangeSourceSQL(t *testing.T) {
+	cfg := &ReplicaConfig{SourceHost: "10.0.0.1", User: "repl", Password: "p'w", AutoPosition: true, Channel: "ch1", SSL: true, SSLCA: "/etc/ca.pem"}
+	got, err := buildChangeSourceSQL(cfg, [3]int{5, 7, 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `CHANGE MASTER TO MASTER_HOST='10.0.0.1',MASTER_PORT=3306,MASTER_USER='repl',MASTER_PASSWORD='p''w',MASTER_AUTO_POSITION=1,MASTER_SSL=1,MASTER_SSL_CA='/etc/ca.pem' FOR CHANNEL 'ch1'`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	cfg = &ReplicaConfig{SourceHost: "h", SourcePort: 3307, User: "repl", LogFile: "mysql-bin.000002", LogPos: 154, GetSourcePublicKey: true}
+	if got, err = buildChangeSourceSQL(cfg, [3]int{8, 0, 30}); err != nil {
+		t.Fatal(err)
+	}
+	want = `CHANGE REPLICATION SOURCE TO SOURCE_HOST='h',SOURCE_PORT=3307,SOURCE_USER='repl',SOURCE_PASSWORD='',SOURCE_AUTO_POSITION=0,SOURCE_LOG_FILE='mysql-bin.000002',SOURCE_LOG_POS=154,SOURCE_SSL=0,GET_SOURCE_PUBLIC_KEY=1`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	for _, bad := range []*ReplicaConfig{
+		{User: "repl", AutoPosition: true},
+		{SourceHost: "h", User: "repl"},
+		{SourceHost: "h", User: "repl", AutoPosition: true, LogFile: "f"},
+	} {
+		if _, err := buildChangeSourceSQL(bad, [3]int{8, 0, 30}); err == nil {
+			t.Errorf("expected error for %+v", bad)
+		}
+	}
+}
+
+func TestBuildReplicaThreadSQL(t *testing.T) {
+	cases := []struct {
+		verb, thread, channel string
+		version               [3]int
+		want                  string
+	}{
+		{"START", "", "", [3]int{5, 7, 30}, "START SLAVE"},
+		{"STOP", ReplicaIOThread, "ch1", [3]int{5, 7, 30}, "STOP SLAVE IO_THREAD FOR CHANNEL 'ch1'"},
+		{"START", ReplicaSQLThread, "", [3]int{8, 0, 22}, "START REPLICA SQL_THREAD"},
+	}
+	for _, c := range cases {
+		got, err := buildReplicaThreadSQL(c.verb, c.thread, c.channel, c.version)
+		if err != nil || got != c.want {
+			t.Errorf("buildReplicaThreadSQL(%s,%s,%s)=%s,%v,want %s", c.verb, c.thread, c.channel, got, err, c.want)
+		}
+	}
+	if _, err := buildReplicaThreadSQL("START", "RELAY_THREAD", "", [3]int{8, 0, 30}); err == nil {
+		t.Errorf("invalid thread should fail")
+	}
+}
+
+func TestFailedGtidPattern(t *testing.T) {
+	uuid := "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	if m := failedGtidPattern.FindStringSubmatch("Worker 1 failed executing transaction '" + uuid + ":23' at master log"); m == nil || m[1] != uuid+":23" {
+		t.Errorf("unexpected match:%v", m)
+	}
+}
@@ -0,0 +1,230 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+//角色信息
+type RoleInfo struct {
+	Account
+	Members    []*RoleMember //被授予该角色的账号
+	Privileges []*Privilege  //角色拥有的权限
+}
+
+//角色成员
+type RoleMember struct {
+	Account
+	AdminOption bool //是否WITH ADMIN OPTION
+	Default     bool //是否为该账号的默认角色
+}
+
+//角色从MySQL 8.0开始支持
+func (d *DBHandler) checkRoleSupport(ctx context.Context) error {
+	version, err := d.GetVersionContext(ctx)
+	if err != nil {
+		return err
+	}
+	if version[0] < 8 {
+		return errors.New(fmt.Sprintf("角色需要MySQL 8.0及以上版本,当前版本:%v", version))
+	}
+	return nil
+}
+
+//角色的host为空时默认为%
+func roleName(role, host string) string {
+	if host == "" {
+		host = "%"
+	}
+	return userName(role, host)
+}
+
+//创建一个角色
+func (d *DBHandler) CreateRole(role, host string) error {
+	return d.CreateRoleContext(context.Background(), role, host)
+}
+
+//同CreateRole,ctx用于超时和取消控制
+func (d *DBHandler) CreateRoleContext(ctx context.Context, role, host string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	if err := d.checkRoleSupport(ctx); err != nil {
+		return err
+	}
+	_, err := d.conn.ExecContext(ctx, fmt.Sprintf("CREATE ROLE %s", roleName(role, host)))
+	return err
+}
+
+//删除一个角色,被授予该角色的账号会自动失去该角色
+func (d *DBHandler) DropRole(role, host string) error {
+	return d.DropRoleContext(context.Background(), role, host)
+}
+
+//同DropRole,ctx用于超时和取消控制
+func (d *DBHandler) DropRoleContext(ctx context.Context, role, host string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	if err := d.checkRoleSupport(ctx); err != nil {
+		return err
+	}
+	_, err := d.conn.ExecContext(ctx, fmt.Sprintf("DROP ROLE %s", roleName(role, host)))
+	return err
+}
+
+//将角色授予一个账号,adminOption为true时该账号可以将角色再授予其他账号
+func (d *DBHandler) GrantRole(role, roleHost, user, host string, adminOption bool) error {
+	return d.GrantRoleContext(context.Background(), role, roleHost, user, host, adminOption)
+}
+
+//同GrantRole,ctx用于超时和取消控制
+func (d *DBHandler) GrantRoleContext(ctx context.Context, role, roleHost, user, host string, adminOption bool) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	if err := d.checkRoleSupport(ctx); err != nil {
+		return err
+	}
+	grantRoleSQL := fmt.Sprintf("GRANT %s TO %s", roleName(role, roleHost), userName(user, host))
+	if adminOption {
+		grantRoleSQL += " WITH ADMIN OPTION"
+	}
+	_, err := d.conn.ExecContext(ctx, grantRoleSQL)
+	return err
+}
+
+//回收一个账号的角色
+func (d *DBHandler) RevokeRole(role, roleHost, user, host string) error {
+	return d.RevokeRoleContext(context.Background(), role, roleHost, user, host)
+}
+
+//同RevokeRole,ctx用于超时和取消控制
+func (d *DBHandler) RevokeRoleContext(ctx context.Context, role, roleHost, user, host string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	if err := d.checkRoleSupport(ctx); err != nil {
+		return err
+	}
+	_, err := d.conn.ExecContext(ctx, fmt.Sprintf("REVOKE %s FROM %s", roleName(role, roleHost), userName(user, host)))
+	return err
+}
+
+//设置账号的默认角色,roles为空时取消所有默认角色,角色必须已经授予该账号
+func (d *DBHandler) SetDefaultRoles(user, host string, roles []Account) error {
+	return d.SetDefaultRolesContext(context.Background(), user, host, roles)
+}
+
+//同SetDefaultRoles,ctx用于超时和取消控制
+func (d *DBHandler) SetDefaultRolesContext(ctx context.Context, user, host string, roles []Account) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	if err := d.checkRoleSupport(ctx); err != nil {
+		return err
+	}
+	roleText := "NONE"
+	if len(roles) > 0 {
+		list := make([]string, 0, len(roles))
+		for _, r := range roles {
+			list = append(list, roleName(r.User, r.Host))
+		}
+		roleText = strings.Join(list, ",")
+	}
+	_, err := d.conn.ExecContext(ctx, fmt.Sprintf("SET DEFAULT ROLE %s TO %s", roleText, userName(user, host)))
+	return err
+}
+
+//查看所有的角色以及角色的成员和权限
+//CREATE ROLE创建的账号是锁定的、密码过期且没有密码,已经授予给其他账号的账号也当作角色
+func (d *DBHandler) ListRoles() ([]*RoleInfo, error) {
+	return d.ListRolesContext(context.Background())
+}
+
+//同ListRoles,ctx用于超时和取消控制
+func (d *DBHandler) ListRolesContext(ctx context.Context) ([]*RoleInfo, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	if err := d.checkRoleSupport(ctx); err != nil {
+		return nil, err
+	}
+	listRolesSQL := "SELECT user,host FROM mysql.user WHERE account_locked='Y' AND password_expired='Y' AND authentication_string=''" +
+		" UNION SELECT from_user,from_host FROM mysql.role_edges ORDER BY 1,2"
+	rows, err := d.conn.QueryContext(ctx, listRolesSQL)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		roles   = make([]*RoleInfo, 0)
+		roleMap = make(map[Account]*RoleInfo, 0)
+	)
+	for rows.Next() {
+		role := new(RoleInfo)
+		if err := rows.Scan(&role.User, &role.Host); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		roles = append(roles, role)
+		roleMap[role.Account] = role
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	//查找角色成员以及默认角色
+	defaults := make(map[[2]Account]bool, 0)
+	rows, err = d.conn.QueryContext(ctx, "SELECT user,host,default_role_user,default_role_host FROM mysql.default_roles")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var member, role Account
+		if err := rows.Scan(&member.User, &member.Host, &role.User, &role.Host); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		defaults[[2]Account{role, member}] = true
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	rows, err = d.conn.QueryContext(ctx, "SELECT from_user,from_host,to_user,to_host,with_admin_option FROM mysql.role_edges ORDER BY to_user,to_host")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var (
+			role        Account
+			member      = new(RoleMember)
+			adminOption string
+		)
+		if err := rows.Scan(&role.User, &role.Host, &member.User, &member.Host, &adminOption); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		member.AdminOption = adminOption == "Y"
+		member.Default = defaults[[2]Account{role, member.Account}]
+		if r, ok := roleMap[role]; ok {
+			r.Members = append(r.Members, member)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	//查找角色的权限
+	for _, role := range roles {
+		if role.Privileges, err = d.ShowGrantsContext(ctx, role.User, role.Host); err != nil {
+			return nil, err
+		}
+	}
+	return roles, nil
+}
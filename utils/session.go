@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/pkg/errors"
+	"regexp"
+	"strings"
+)
+
+//会话信息,对应information_schema.processlist中的一行
+type Session struct {
+	Id      int
+	User    string
+	Host    string //客户端地址,形如host:port或localhost
+	DB      string
+	Command string //Query,Sleep,Binlog Dump等
+	Time    int    //当前状态持续的秒数
+	State   string
+	Info    string //正在执行的SQL语句
+}
+
+//获取客户端主机名,去掉端口号部分
+func (s *Session) ClientHost() string {
+	if i := strings.LastIndex(s.Host, ":"); i >= 0 {
+		return s.Host[:i]
+	}
+	return s.Host
+}
+
+//会话过滤条件,各条件之间为AND关系,字段为零值时表示不按该字段过滤
+//例如:杀掉reporting主机上运行超过60秒的查询语句
+//	SessionFilter{ClientHost: "reporting", MinTime: 60, SQLPrefix: "SELECT"}
+type SessionFilter struct {
+	Ids        []int          //指定的session id列表
+	User       string         //用户名
+	ClientHost string         //客户端主机名,不包含端口号
+	DB         string         //当前所在的数据库
+	Command    string         //会话命令类型,忽略大小写
+	MinTime    int            //运行时间大于等于该值(秒)
+	SQLPrefix  string         //SQL语句前缀,如SELECT,忽略大小写以及语句前的空白和注释
+	InfoRegexp *regexp.Regexp //对SQL语句进行正则匹配
+}
+
+//判断会话是否满足过滤条件
+func (f *SessionFilter) Match(s *Session) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Ids) > 0 {
+		found := false
+		for _, id := range f.Ids {
+			if id == s.Id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.User != "" && f.User != s.User {
+		return false
+	}
+	if f.ClientHost != "" && f.ClientHost != s.ClientHost() {
+		return false
+	}
+	if f.DB != "" && f.DB != s.DB {
+		return false
+	}
+	if f.Command != "" && !strings.EqualFold(f.Command, s.Command) {
+		return false
+	}
+	if f.MinTime > 0 && s.Time < f.MinTime {
+		return false
+	}
+	if f.SQLPrefix != "" && !hasSQLPrefix(s.Info, f.SQLPrefix) {
+		return false
+	}
+	if f.InfoRegexp != nil && !f.InfoRegexp.MatchString(s.Info) {
+		return false
+	}
+	return true
+}
+
+//判断SQL语句是否以指定的关键字开头,跳过语句前的空白、括号和注释
+func hasSQLPrefix(query, prefix string) bool {
+	query = stripSQLLeading(query)
+	if len(query) < len(prefix) || !strings.EqualFold(query[:len(prefix)], prefix) {
+		return false
+	}
+	//需要完整匹配关键字,避免SELECTX之类的误匹配
+	if len(query) == len(prefix) {
+		return true
+	}
+	c := query[len(prefix)]
+	return !(c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z')
+}
+
+//去掉SQL语句开头的空白、左括号以及注释
+func stripSQLLeading(query string) string {
+	for {
+		query = strings.TrimLeft(query, " \t\r\n(")
+		switch {
+		case strings.HasPrefix(query, "/*"):
+			end := strings.Index(query, "*/")
+			if end < 0 {
+				return ""
+			}
+			query = query[end+2:]
+		case strings.HasPrefix(query, "#"), strings.HasPrefix(query, "-- "):
+			end := strings.Index(query, "\n")
+			if end < 0 {
+				return ""
+			}
+			query = query[end+1:]
+		default:
+			return query
+		}
+	}
+}
+
+//查看会话的语句,用于在会话列表中识别自身
+const listSessionsSQL = "select id,user,host,db,command,time,state,info from information_schema.processlist"
+
+//查看满足过滤条件的会话,filter为nil时返回所有会话
+func (d *DBHandler) ListSessions(filter *SessionFilter) ([]*Session, error) {
+	return d.ListSessionsContext(context.Background(), filter)
+}
+
+//同ListSessions,ctx用于超时和取消控制
+func (d *DBHandler) ListSessionsContext(ctx context.Context, filter *SessionFilter) ([]*Session, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	return listSessions(ctx, d.conn, filter)
+}
+
+//sql.DB和sql.Conn共同的查询接口
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func listSessions(ctx context.Context, q queryer, filter *SessionFilter) ([]*Session, error) {
+	rows, err := q.QueryContext(ctx, listSessionsSQL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var (
+		sessions []*Session
+		host     sql.NullString
+		db       sql.NullString
+		state    sql.NullString
+		info     sql.NullString
+	)
+	sessions = make([]*Session, 0)
+	for rows.Next() {
+		s := new(Session)
+		if err := rows.Scan(&s.Id, &s.User, &host, &db, &s.Command, &s.Time, &state, &info); err != nil {
+			return nil, err
+		}
+		s.Host, s.DB, s.State, s.Info = host.String, db.String, state.String, info.String
+		if filter.Match(s) {
+			sessions = append(sessions, s)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+//杀会话的结果
+type KillResult struct {
+	Session *Session
+	Killed  bool  //是否已经被杀掉,dryRun时为false
+	Err     error //杀会话失败的原因
+}
+
+//杀掉满足过滤条件的会话,dryRun为true时只返回将要被杀掉的会话而不真正执行
+//当前连接以及系统后台线程不会被杀掉
+func (d *DBHandler) KillSessions(filter *SessionFilter, dryRun bool) ([]*KillResult, error) {
+	return d.KillSessionsContext(context.Background(), filter, dryRun)
+}
+
+//同KillSessions,ctx用于超时和取消控制
+func (d *DBHandler) KillSessionsContext(ctx context.Context, filter *SessionFilter, dryRun bool) ([]*KillResult, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	//查询connection_id、查看会话以及kill都在同一个连接上执行,保证排除的是执行kill的连接
+	conn, err := d.conn.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var connectionId int
+	if err := conn.QueryRowContext(ctx, "select connection_id()").Scan(&connectionId); err != nil {
+		return nil, err
+	}
+	sessions, err := listSessions(ctx, conn, filter)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*KillResult, 0, len(sessions))
+	for _, s := range sessions {
+		if s.Id == connectionId || s.User == "system user" || s.User == "event_scheduler" {
+			continue
+		}
+		result := &KillResult{Session: s}
+		if !dryRun {
+			if _, err := conn.ExecContext(ctx, fmt.Sprintf("kill %d", s.Id)); err != nil {
+				result.Err = err
+			} else {
+				result.Killed = true
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+//将杀会话的结果汇总成一个错误,全部成功时返回nil
+func killResultsError(results []*KillResult) error {
+	var (
+		sessionIds         []int
+		unKilledSessionIds []int
+	)
+	for _, r := range results {
+		sessionIds = append(sessionIds, r.Session.Id)
+		if r.Err != nil {
+			unKilledSessionIds = append(unKilledSessionIds, r.Session.Id)
+		}
+	}
+	if len(unKilledSessionIds) == 0 {
+		return nil
+	}
+	return errors.New(fmt.Sprintf("Need kill sessions:%v,unkilled sessions:%v", sessionIds, unKilledSessionIds))
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestSessionFilter_Match(t *testing.T) {
+	s := &Session{
+		Id:      10,
+		User:    "report",
+		Host:    "reporting:52314",
+		DB:      "sales",
+		Command: "Query",
+		Time:    75,
+		State:   "Sending data",
+		Info:    " /* report */ select count(*) from orders",
+	}
+	cases := []struct {
+		name   string
+		filter *SessionFilter
+		want   bool
+	}{
+		{"nil", nil, true},
+		{"empty", &SessionFilter{}, true},
+		{"ids", &SessionFilter{Ids: []int{1, 10}}, true},
+		{"ids miss", &SessionFilter{Ids: []int{1}}, false},
+		{"user", &SessionFilter{User: "report"}, true},
+		{"user miss", &SessionFilter{User: "root"}, false},
+		{"client host", &SessionFilter{ClientHost: "reporting"}, true},
+		{"client host miss", &SessionFilter{ClientHost: "reporting:52314"}, false},
+		{"db", &SessionFilter{DB: "sales"}, true},
+		{"command", &SessionFilter{Command: "query"}, true},
+		{"min time", &SessionFilter{MinTime: 60}, true},
+		{"min time miss", &SessionFilter{MinTime: 100}, false},
+		{"select prefix", &SessionFilter{SQLPrefix: "SELECT"}, true},
+		{"update prefix", &SessionFilter{SQLPrefix: "UPDATE"}, false},
+		{"partial keyword", &SessionFilter{SQLPrefix: "SEL"}, false},
+		{"regexp", &SessionFilter{InfoRegexp: regexp.MustCompile(`(?i)from\s+orders`)}, true},
+		{"combined", &SessionFilter{ClientHost: "reporting", MinTime: 60, SQLPrefix: "select"}, true},
+		{"combined miss", &SessionFilter{ClientHost: "reporting", MinTime: 60, SQLPrefix: "delete"}, false},
+	}
+	for _, c := range cases {
+		if got := c.filter.Match(s); got != c.want {
+			t.Errorf("%s: Match()=%v,want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestSession_ClientHost(t *testing.T) {
+	cases := map[string]string{
+		"10.0.0.1:3306": "10.0.0.1",
+		"localhost":     "localhost",
+		"":              "",
+	}
+	for host, want := range cases {
+		s := &Session{Host: host}
+		if got := s.ClientHost(); got != want {
+			t.Errorf("ClientHost(%q)=%q,want %q", host, got, want)
+		}
+	}
+}
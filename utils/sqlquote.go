@@ -0,0 +1,233 @@
+package utils
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"regexp"
+	"strings"
+)
+
+//SQL语句拼接时使用的转义工具
+//DDL/DCL语句无法使用?占位符,所有外部传入的名称都必须经过这里的函数转义或校验后才能拼接进SQL
+
+//将标识符(库名、表名、列名等)用反引号括起来,内部的反引号转义为两个反引号
+func quoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+//将字符串转义成SQL字符串常量,前后加单引号
+//单引号转义为两个单引号,在任何sql_mode下都不会提前结束字符串;反斜杠转义为两个反斜杠,
+//为了让反斜杠的含义确定,连接建立时会从sql_mode中去掉NO_BACKSLASH_ESCAPES,见noBackslashEscapesSQLMode
+func quoteLiteral(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `''`).Replace(s) + "'"
+}
+
+var (
+	//字符集、排序规则、认证插件等只允许字母数字下划线
+	keywordPattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	//参数名,允许组件参数形式如validate_password.policy
+	variableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+	//数值类型的参数值
+	numericValuePattern = regexp.MustCompile(`^-?\d+(\.\d+)?$`)
+	//动态权限,如BACKUP_ADMIN,SYSTEM_VARIABLES_ADMIN
+	dynamicPrivPattern = regexp.MustCompile(`^[A-Z]+(_[A-Z]+)+$`)
+	//带列名的权限,如SELECT (c1,c2)
+	columnPrivPattern = regexp.MustCompile(`^([A-Z ]+?)\s*\((.*)\)$`)
+)
+
+//静态权限关键字
+var staticPrivileges = map[string]bool{
+	"ALL":                     true,
+	"ALL PRIVILEGES":          true,
+	"ALTER":                   true,
+	"ALTER ROUTINE":           true,
+	"CREATE":                  true,
+	"CREATE ROLE":             true,
+	"CREATE ROUTINE":          true,
+	"CREATE TABLESPACE":       true,
+	"CREATE TEMPORARY TABLES": true,
+	"CREATE USER":             true,
+	"CREATE VIEW":             true,
+	"DELETE":                  true,
+	"DROP":                    true,
+	"DROP ROLE":               true,
+	"EVENT":                   true,
+	"EXECUTE":                 true,
+	"FILE":                    true,
+	"GRANT OPTION":            true,
+	"INDEX":                   true,
+	"INSERT":                  true,
+	"LOCK TABLES":             true,
+	"PROCESS":                 true,
+	"PROXY":                   true,
+	"REFERENCES":              true,
+	"RELOAD":                  true,
+	"REPLICATION CLIENT":      true,
+	"REPLICATION SLAVE":       true,
+	"SELECT":                  true,
+	"SHOW DATABASES":          true,
+	"SHOW VIEW":               true,
+	"SHUTDOWN":                true,
+	"SUPER":                   true,
+	"TRIGGER":                 true,
+	"UPDATE":                  true,
+	"USAGE":                   true,
+}
+
+//可以指定列名的权限
+var columnPrivileges = map[string]bool{
+	"SELECT":     true,
+	"INSERT":     true,
+	"UPDATE":     true,
+	"REFERENCES": true,
+}
+
+//校验字符集、排序规则、认证插件等关键字
+func checkKeyword(kind, s string) error {
+	if !keywordPattern.MatchString(s) {
+		return errors.New(fmt.Sprintf("非法的%s:%q", kind, s))
+	}
+	return nil
+}
+
+//校验参数名
+func checkVariableName(name string) error {
+	if !variableNamePattern.MatchString(name) {
+		return errors.New(fmt.Sprintf("非法的参数名:%q", name))
+	}
+	return nil
+}
+
+//将参数值转换成SQL形式,数值和ON/OFF等关键字原样输出,其余作为字符串常量
+func quoteVariableValue(value string) string {
+	switch strings.ToUpper(value) {
+	case "ON", "OFF", "TRUE", "FALSE", "DEFAULT":
+		return strings.ToUpper(value)
+	}
+	if numericValuePattern.MatchString(value) {
+		return value
+	}
+	return quoteLiteral(value)
+}
+
+//将大小写、空白不规范的权限统一成大写单空格形式
+func normalizePrivilege(priv string) string {
+	return strings.Join(strings.Fields(strings.ToUpper(priv)), " ")
+}
+
+//校验并格式化单个权限,列权限中的列名会被转义
+func formatPrivilege(priv string) (string, error) {
+	p := normalizePrivilege(priv)
+	if subMatch := columnPrivPattern.FindStringSubmatch(p); len(subMatch) != 0 {
+		//列名需要保留原始大小写,从原始字符串中取出
+		raw := strings.TrimSpace(priv)
+		colText := raw[strings.Index(raw, "(")+1 : strings.LastIndex(raw, ")")]
+		if !columnPrivileges[subMatch[1]] {
+			return "", errors.New(fmt.Sprintf("权限%s不支持指定列", subMatch[1]))
+		}
+		var cols []string
+		for _, c := range strings.Split(colText, ",") {
+			c = strings.Trim(strings.TrimSpace(c), "`")
+			if c == "" {
+				return "", errors.New(fmt.Sprintf("非法的列权限:%q", priv))
+			}
+			cols = append(cols, quoteIdentifier(c))
+		}
+		return fmt.Sprintf("%s (%s)", subMatch[1], strings.Join(cols, ",")), nil
+	}
+	if staticPrivileges[p] || dynamicPrivPattern.MatchString(p) {
+		return p, nil
+	}
+	return "", errors.New(fmt.Sprintf("非法的权限:%q", priv))
+}
+
+//校验并格式化权限列表
+func formatPrivileges(privs []string) (string, error) {
+	if len(privs) == 0 {
+		return "", errors.New("权限列表为空")
+	}
+	list := make([]string, 0, len(privs))
+	for _, priv := range privs {
+		p, err := formatPrivilege(priv)
+		if err != nil {
+			return "", err
+		}
+		list = append(list, p)
+	}
+	return strings.Join(list, ","), nil
+}
+
+//校验对象类型:TABLE,FUNCTION,PROCEDURE,可以为空
+func formatObjectType(objectType string) (string, error) {
+	switch t := strings.ToUpper(strings.TrimSpace(objectType)); t {
+	case "", "TABLE", "FUNCTION", "PROCEDURE":
+		return t, nil
+	default:
+		return "", errors.New(fmt.Sprintf("非法的对象类型:%q", objectType))
+	}
+}
+
+//将权限级别拆分成库名和对象名两部分,支持反引号括起来的名称
+//*,*.*,db_name.*,db_name.tbl_name,tbl_name,db_name.routine_name
+func splitPrivLevel(privLevel string) ([]string, error) {
+	var (
+		parts   []string
+		cur     strings.Builder
+		quoted  bool //当前部分是否用反引号括起来
+		inQuote bool
+	)
+	s := strings.TrimSpace(privLevel)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case inQuote && c == '`' && i+1 < len(s) && s[i+1] == '`':
+			cur.WriteByte('`')
+			i++
+		case inQuote && c == '`':
+			inQuote = false
+		case inQuote:
+			cur.WriteByte(c)
+		case c == '`' && cur.Len() == 0 && !quoted:
+			inQuote, quoted = true, true
+		case c == '.':
+			parts = append(parts, cur.String())
+			cur.Reset()
+			quoted = false
+		case quoted:
+			return nil, errors.New(fmt.Sprintf("非法的权限级别:%q", privLevel))
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	if inQuote {
+		return nil, errors.New(fmt.Sprintf("非法的权限级别:%q", privLevel))
+	}
+	parts = append(parts, cur.String())
+	if len(parts) > 2 {
+		return nil, errors.New(fmt.Sprintf("非法的权限级别:%q", privLevel))
+	}
+	for _, p := range parts {
+		if p == "" {
+			return nil, errors.New(fmt.Sprintf("非法的权限级别:%q", privLevel))
+		}
+	}
+	return parts, nil
+}
+
+//校验并格式化权限级别,除*以外的名称都用反引号转义
+func formatPrivLevel(privLevel string) (string, error) {
+	parts, err := splitPrivLevel(privLevel)
+	if err != nil {
+		return "", err
+	}
+	//*.tbl_name这种形式是不允许的
+	if len(parts) == 2 && parts[0] == "*" && parts[1] != "*" {
+		return "", errors.New(fmt.Sprintf("非法的权限级别:%q", privLevel))
+	}
+	for i, p := range parts {
+		if p != "*" {
+			parts[i] = quoteIdentifier(p)
+		}
+	}
+	return strings.Join(parts, "."), nil
+}
@@ -0,0 +1,161 @@
+package utils
+
+import "testing"
+
+func TestQuoteIdentifier(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"db1", "`db1`"},
+		{"my-db", "`my-db`"},
+		{"a`b", "`a``b`"},
+		{"`; drop database mysql; `", "```; drop database mysql; ```"},
+		{"", "``"},
+	}
+	for _, c := range cases {
+		if got := quoteIdentifier(c.in); got != c.want {
+			t.Errorf("quoteIdentifier(%q)=%s,want %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestQuoteLiteral(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"abc", `'abc'`},
+		{"it's", `'it''s'`},
+		{`a\b`, `'a\\b'`},
+		{"x' OR '1'='1", `'x'' OR ''1''=''1'`},
+		{`x\' OR 1=1 -- `, `'x\\'' OR 1=1 -- '`},
+		{"a\nb", "'a\nb'"},
+		{`"q"`, `'"q"'`},
+		{"", `''`},
+	}
+	for _, c := range cases {
+		if got := quoteLiteral(c.in); got != c.want {
+			t.Errorf("quoteLiteral(%q)=%s,want %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestUserName(t *testing.T) {
+	cases := []struct {
+		user, host, want string
+	}{
+		{"u1", "", `'u1'`},
+		{"u1", "%", `'u1'@'%'`},
+		{"o'brien", "10.0.0.%", `'o''brien'@'10.0.0.%'`},
+	}
+	for _, c := range cases {
+		if got := userName(c.user, c.host); got != c.want {
+			t.Errorf("userName(%q,%q)=%s,want %s", c.user, c.host, got, c.want)
+		}
+	}
+}
+
+func TestFormatPrivileges(t *testing.T) {
+	cases := []struct {
+		in      []string
+		want    string
+		wantErr bool
+	}{
+		{[]string{"select", "Insert"}, "SELECT,INSERT", false},
+		{[]string{"create  temporary tables"}, "CREATE TEMPORARY TABLES", false},
+		{[]string{"ALL PRIVILEGES"}, "ALL PRIVILEGES", false},
+		{[]string{"backup_admin"}, "BACKUP_ADMIN", false},
+		{[]string{"SELECT (id, Name)"}, "SELECT (`id`,`Name`)", false},
+		{[]string{"DELETE (id)"}, "", true},
+		{[]string{"SELECT ON *.* TO x; --"}, "", true},
+		{[]string{"DROPX"}, "", true},
+		{nil, "", true},
+	}
+	for _, c := range cases {
+		got, err := formatPrivileges(c.in)
+		if (err != nil) != c.wantErr {
+			t.Errorf("formatPrivileges(%q) err=%v,wantErr %v", c.in, err, c.wantErr)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("formatPrivileges(%q)=%s,want %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestFormatPrivLevel(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"*", "*", false},
+		{"*.*", "*.*", false},
+		{"db1.*", "`db1`.*", false},
+		{"db1.t1", "`db1`.`t1`", false},
+		{"t1", "`t1`", false},
+		{"`my.db`.`t``1`", "`my.db`.`t``1`", false},
+		{"*.t1", "", true},
+		{"a.b.c", "", true},
+		{"db1.", "", true},
+		{"`db1", "", true},
+		{"`db1`x.t1", "", true},
+	}
+	for _, c := range cases {
+		got, err := formatPrivLevel(c.in)
+		if (err != nil) != c.wantErr {
+			t.Errorf("formatPrivLevel(%q) err=%v,wantErr %v", c.in, err, c.wantErr)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("formatPrivLevel(%q)=%s,want %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestFormatObjectType(t *testing.T) {
+	for in, wantErr := range map[string]bool{"": false, "table": false, "PROCEDURE": false, "FUNCTION": false, "VIEW": true, "TABLE;": true} {
+		if _, err := formatObjectType(in); (err != nil) != wantErr {
+			t.Errorf("formatObjectType(%q) err=%v,wantErr %v", in, err, wantErr)
+		}
+	}
+}
+
+func TestCheckVariableName(t *testing.T) {
+	for in, wantErr := range map[string]bool{
+		"max_connections":          false,
+		"validate_password.policy": false,
+		"max_connections=1;drop":   true,
+		"":                         true,
+		"1abc":                     true,
+	} {
+		if err := checkVariableName(in); (err != nil) != wantErr {
+			t.Errorf("checkVariableName(%q) err=%v,wantErr %v", in, err, wantErr)
+		}
+	}
+}
+
+func TestQuoteVariableValue(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"1000", "1000"},
+		{"-1", "-1"},
+		{"0.5", "0.5"},
+		{"on", "ON"},
+		{"ROW", `'ROW'`},
+		{"1; drop database mysql", `'1; drop database mysql'`},
+	}
+	for _, c := range cases {
+		if got := quoteVariableValue(c.in); got != c.want {
+			t.Errorf("quoteVariableValue(%q)=%s,want %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestCheckKeyword(t *testing.T) {
+	for in, wantErr := range map[string]bool{"utf8mb4": false, "utf8mb4_0900_ai_ci": false, "utf8 collate x": true, "": true} {
+		if err := checkKeyword("字符集", in); (err != nil) != wantErr {
+			t.Errorf("checkKeyword(%q) err=%v,wantErr %v", in, err, wantErr)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//按前缀识别的累计型状态变量,其中的pending等瞬时值由statusGaugeSubstrings排除
+var statusCounterPrefixes = []string{
+	"Com_", "Handler_", "Innodb_rows_", "Innodb_data_", "Innodb_pages_", "Innodb_dblwr_",
+	"Select_", "Sort_", "Created_tmp_", "Bytes_", "Binlog_", "Key_read", "Key_write",
+}
+
+//前缀匹配但属于瞬时值的状态变量
+var statusGaugeSubstrings = []string{"_pending_"}
+
+//不符合前缀规则的累计型状态变量
+var statusCounters = map[string]bool{
+	"Questions":                             true,
+	"Queries":                               true,
+	"Connections":                           true,
+	"Aborted_clients":                       true,
+	"Aborted_connects":                      true,
+	"Slow_queries":                          true,
+	"Opened_files":                          true,
+	"Opened_tables":                         true,
+	"Opened_table_definitions":              true,
+	"Table_locks_immediate":                 true,
+	"Table_locks_waited":                    true,
+	"Table_open_cache_hits":                 true,
+	"Table_open_cache_misses":               true,
+	"Table_open_cache_overflows":            true,
+	"Threads_created":                       true,
+	"Innodb_buffer_pool_read_requests":      true,
+	"Innodb_buffer_pool_reads":              true,
+	"Innodb_buffer_pool_read_ahead":         true,
+	"Innodb_buffer_pool_read_ahead_evicted": true,
+	"Innodb_buffer_pool_wait_free":          true,
+	"Innodb_buffer_pool_write_requests":     true,
+	"Innodb_buffer_pool_pages_flushed":      true,
+	"Innodb_log_waits":                      true,
+	"Innodb_log_write_requests":             true,
+	"Innodb_log_writes":                     true,
+	"Innodb_os_log_fsyncs":                  true,
+	"Innodb_os_log_written":                 true,
+	"Innodb_row_lock_time":                  true,
+	"Innodb_row_lock_waits":                 true,
+}
+
+//判断状态变量是否为累计型的计数器,计数器在Diff中计算每秒增量,其它的视为瞬时值
+func isStatusCounter(name string) bool {
+	if statusCounters[name] {
+		return true
+	}
+	for _, s := range statusGaugeSubstrings {
+		if strings.Contains(name, s) {
+			return false
+		}
+	}
+	for _, prefix := range statusCounterPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+//某一时刻的全局状态
+type StatusSnapshot struct {
+	Time   time.Time          //采样完成的时间
+	Values map[string]float64 //可以解析为数字的状态值
+	Raw    map[string]string  //原始的状态值,包含ON/OFF等非数字的值
+}
+
+//数字型的状态值,不存在或者不是数字时为0
+func (s *StatusSnapshot) Value(name string) float64 {
+	return s.Values[name]
+}
+
+//将SHOW GLOBAL STATUS的结果解析为快照
+func newStatusSnapshot(t time.Time, raw map[string]string) *StatusSnapshot {
+	s := &StatusSnapshot{Time: t, Values: make(map[string]float64, len(raw)), Raw: raw}
+	for k, v := range raw {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			s.Values[k] = f
+		}
+	}
+	return s
+}
+
+//采集一次全局状态的快照
+func (d *DBHandler) GlobalStatusSnapshot() (*StatusSnapshot, error) {
+	return d.GlobalStatusSnapshotContext(context.Background())
+}
+
+//同GlobalStatusSnapshot,ctx用于超时和取消控制
+func (d *DBHandler) GlobalStatusSnapshotContext(ctx context.Context) (*StatusSnapshot, error) {
+	raw, err := d.ShowGlobalStatusContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newStatusSnapshot(time.Now(), raw), nil
+}
+
+//两次快照之间的变化
+type StatusDelta struct {
+	Interval time.Duration      //两次采样的时间间隔
+	Rates    map[string]float64 //计数器的每秒增量
+	Gauges   map[string]float64 //瞬时值,取后一次快照的值
+	QPS      float64            //每秒的语句数,根据Questions计算
+	TPS      float64            //每秒的事务数,根据Com_commit和Com_rollback计算
+}
+
+//计数器每秒增量或者瞬时值,不存在时为0
+func (d *StatusDelta) Value(name string) float64 {
+	if v, ok := d.Rates[name]; ok {
+		return v
+	}
+	return d.Gauges[name]
+}
+
+//计算两次快照之间的变化,prev必须早于cur且中间实例没有重启
+//计数器被FLUSH STATUS重置导致变小时增量记为0
+func Diff(prev, cur *StatusSnapshot) (*StatusDelta, error) {
+	if prev == nil || cur == nil {
+		return nil, errors.New("快照不能为空")
+	}
+	interval := cur.Time.Sub(prev.Time)
+	if interval <= 0 {
+		return nil, errors.New(fmt.Sprintf("快照时间%s不晚于%s", cur.Time.Format(time.RFC3339Nano), prev.Time.Format(time.RFC3339Nano)))
+	}
+	if prevUptime, ok := prev.Values["Uptime"]; ok && cur.Values["Uptime"] < prevUptime {
+		return nil, errors.New("实例在两次快照之间发生了重启")
+	}
+	delta := &StatusDelta{
+		Interval: interval,
+		Rates:    make(map[string]float64, 0),
+		Gauges:   make(map[string]float64, 0),
+	}
+	seconds := interval.Seconds()
+	for name, v := range cur.Values {
+		if !isStatusCounter(name) {
+			delta.Gauges[name] = v
+			continue
+		}
+		prevValue, ok := prev.Values[name]
+		if !ok || v < prevValue {
+			delta.Rates[name] = 0
+			continue
+		}
+		delta.Rates[name] = (v - prevValue) / seconds
+	}
+	delta.QPS = delta.Rates["Questions"]
+	delta.TPS = delta.Rates["Com_commit"] + delta.Rates["Com_rollback"]
+	return delta, nil
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsStatusCounter(t *testing.T) {
+	tests := []struct {
+		name    string
+		counter bool
+	}{
+		{"Questions", true},
+		{"Com_select", true},
+		{"Innodb_rows_read", true},
+		{"Bytes_sent", true},
+		{"Innodb_data_reads", true},
+		{"Innodb_data_pending_reads", false},
+		{"Threads_running", false},
+		{"Threads_created", true},
+		{"Innodb_buffer_pool_pages_free", false},
+		{"Innodb_buffer_pool_read_requests", true},
+		{"Uptime", false},
+	}
+	for _, tt := range tests {
+		if got := isStatusCounter(tt.name); got != tt.counter {
+			t.Errorf("isStatusCounter(%s)=%v,want %v", tt.name, got, tt.counter)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	start := time.Date(2023, 1, 5, 9, 0, 0, 0, time.UTC)
+	prev := newStatusSnapshot(start, map[string]string{
+		"Uptime":           "100",
+		"Questions":        "1000",
+		"Com_commit":       "100",
+		"Com_rollback":     "10",
+		"Bytes_sent":       "5000",
+		"Threads_running":  "3",
+		"Innodb_rows_read": "200",
+	})
+	cur := newStatusSnapshot(start.Add(10*time.Second), map[string]string{
+		"Uptime":                      "110",
+		"Questions":                   "3000",
+		"Com_commit":                  "300",
+		"Com_rollback":                "10",
+		"Bytes_sent":                  "4000",
+		"Threads_running":             "8",
+		"Innodb_rows_read":            "1200",
+		"Innodb_rows_inserted":        "50",
+		"Ssl_cipher":                  "",
+		"Rpl_semi_sync_master_status": "ON",
+	})
+	delta, err := Diff(prev, cur)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delta.Interval != 10*time.Second || delta.QPS != 200 || delta.TPS != 20 {
+		t.Errorf("unexpected delta:%+v", delta)
+	}
+	if delta.Value("Innodb_rows_read") != 100 || delta.Value("Threads_running") != 8 || delta.Value("Uptime") != 110 {
+		t.Errorf("unexpected values:%+v", delta)
+	}
+	//计数器变小或者前一次快照中不存在时增量为0
+	if v, ok := delta.Rates["Bytes_sent"]; !ok || v != 0 {
+		t.Errorf("unexpected Bytes_sent rate:%v", v)
+	}
+	if v, ok := delta.Rates["Innodb_rows_inserted"]; !ok || v != 0 {
+		t.Errorf("unexpected Innodb_rows_inserted rate:%v", v)
+	}
+	if _, ok := delta.Gauges["Rpl_semi_sync_master_status"]; ok || cur.Raw["Rpl_semi_sync_master_status"] != "ON" {
+		t.Errorf("non numeric status should only in Raw")
+	}
+	if _, err := Diff(cur, prev); err == nil {
+		t.Errorf("expect error when snapshots are out of order")
+	}
+	restarted := newStatusSnapshot(start.Add(20*time.Second), map[string]string{"Uptime": "5"})
+	if _, err := Diff(cur, restarted); err == nil {
+		t.Errorf("expect error when instance restarted")
+	}
+}
@@ -0,0 +1,619 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	"github.com/wencycool/dbfree/gtid"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//super_read_only从MySQL 5.7.8开始支持
+var superReadOnlyVersion = [3]int{5, 7, 8}
+
+//参与主从切换的实例
+type SwitchoverInstance struct {
+	Host    string //其他实例复制该实例时使用的地址
+	Port    int
+	Handler *DBHandler
+}
+
+func (i *SwitchoverInstance) String() string {
+	return net.JoinHostPort(i.Host, strconv.Itoa(i.Port))
+}
+
+//主从切换的选项
+type SwitchoverOptions struct {
+	Primary   *SwitchoverInstance   //原主库,failover时Handler可以为nil,此时只用于回滚
+	Candidate *SwitchoverInstance   //新主库,failover时为nil表示自动选择GTID最多的从库
+	Replicas  []*SwitchoverInstance //原主库的其他从库,failover时包括所有候选从库
+
+	//从库重新指向新主库时使用的复制账号,复制都使用GTID自动定位
+	ReplUser     string
+	ReplPassword string
+	ReplSSL      bool
+	Channel      string //复制通道,为空时为默认通道
+
+	CatchupTimeout time.Duration //等待从库追平的超时时间,默认为60秒
+	RepointPrimary bool          //switchover完成后原主库作为新主库的从库
+
+	Logger func(format string, v ...interface{}) //切换过程的日志,默认为log.Printf
+}
+
+//切换中的一个步骤,undo为nil表示该步骤不需要或者无法回滚
+type SwitchoverStep struct {
+	Name string
+	do   func(ctx context.Context) error
+	undo func(ctx context.Context) error
+}
+
+//切换计划,String输出计划的内容用于dry-run,Execute按顺序执行
+type SwitchoverPlan struct {
+	Kind      string //switchover或failover
+	Primary   *SwitchoverInstance
+	Candidate *SwitchoverInstance
+	Steps     []*SwitchoverStep
+	logf      func(format string, v ...interface{})
+}
+
+//failover时原主库可能未知
+func (p *SwitchoverPlan) primaryName() string {
+	if p.Primary == nil {
+		return "unknown"
+	}
+	return p.Primary.String()
+}
+
+//failover自动选择候选主库时,执行之前候选主库未知
+func (p *SwitchoverPlan) candidateName() string {
+	if p.Candidate == nil {
+		return "auto"
+	}
+	return p.Candidate.String()
+}
+
+//输出切换计划
+func (p *SwitchoverPlan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s -> %s\n", p.Kind, p.primaryName(), p.candidateName())
+	for i, step := range p.Steps {
+		undo := ""
+		if step.undo == nil {
+			undo = " (不可回滚)"
+		}
+		fmt.Fprintf(&b, "%d. %s%s\n", i+1, step.Name, undo)
+	}
+	return b.String()
+}
+
+//按顺序执行切换计划,某一步失败时按相反的顺序回滚已经完成的步骤
+func (p *SwitchoverPlan) Execute() error {
+	return p.ExecuteContext(context.Background())
+}
+
+//同Execute,ctx用于超时和取消控制,回滚时不使用ctx,避免ctx取消后无法回滚
+func (p *SwitchoverPlan) ExecuteContext(ctx context.Context) error {
+	total := len(p.Steps)
+	for i, step := range p.Steps {
+		p.logf("[%s %d/%d] %s", p.Kind, i+1, total, step.Name)
+		start := time.Now()
+		err := ctx.Err()
+		if err == nil {
+			err = step.do(ctx)
+		}
+		if err == nil {
+			p.logf("[%s %d/%d] 完成,耗时%v", p.Kind, i+1, total, time.Since(start))
+			continue
+		}
+		p.logf("[%s %d/%d] 失败:%v,开始回滚", p.Kind, i+1, total, err)
+		rollbackErrs := make([]string, 0)
+		for j := i - 1; j >= 0; j-- {
+			if p.Steps[j].undo == nil {
+				p.logf("[%s rollback %d/%d] %s 不可回滚,跳过", p.Kind, j+1, total, p.Steps[j].Name)
+				continue
+			}
+			p.logf("[%s rollback %d/%d] %s", p.Kind, j+1, total, p.Steps[j].Name)
+			if undoErr := p.Steps[j].undo(context.Background()); undoErr != nil {
+				p.logf("[%s rollback %d/%d] 失败:%v", p.Kind, j+1, total, undoErr)
+				rollbackErrs = append(rollbackErrs, fmt.Sprintf("%s:%v", p.Steps[j].Name, undoErr))
+			}
+		}
+		err = errors.Wrap(err, step.Name)
+		if len(rollbackErrs) > 0 {
+			err = errors.Wrap(err, "回滚失败,需要人工处理:"+strings.Join(rollbackErrs, ";"))
+		}
+		return err
+	}
+	p.logf("[%s] %s切换到%s成功", p.Kind, p.primaryName(), p.candidateName())
+	return nil
+}
+
+//检查切换选项并填充默认值
+func (o *SwitchoverOptions) normalize() error {
+	if o.CatchupTimeout == 0 {
+		o.CatchupTimeout = 60 * time.Second
+	}
+	if o.Logger == nil {
+		o.Logger = log.Printf
+	}
+	if o.ReplUser == "" {
+		return errors.New("需要指定复制账号ReplUser")
+	}
+	for _, r := range o.Replicas {
+		if r == nil || r.Handler == nil {
+			return errors.New("从库的Handler不能为空")
+		}
+	}
+	return nil
+}
+
+//复制指定主库的配置
+func (o *SwitchoverOptions) replicaConfig(source *SwitchoverInstance) *ReplicaConfig {
+	return &ReplicaConfig{
+		SourceHost:   source.Host,
+		SourcePort:   source.Port,
+		User:         o.ReplUser,
+		Password:     o.ReplPassword,
+		Channel:      o.Channel,
+		AutoPosition: true,
+		SSL:          o.ReplSSL,
+	}
+}
+
+//将实例重新指向新的主库
+func (o *SwitchoverOptions) repoint(ctx context.Context, inst, source *SwitchoverInstance) error {
+	if err := inst.Handler.StopReplicaContext(ctx, o.Channel, ""); err != nil {
+		return err
+	}
+	if err := inst.Handler.ConfigureReplicaContext(ctx, o.replicaConfig(source)); err != nil {
+		return err
+	}
+	return inst.Handler.StartReplicaContext(ctx, o.Channel, "")
+}
+
+//查看实例的只读状态,5.7.8之前的版本superReadOnly始终为false
+func (d *DBHandler) ReadOnly() (readOnly, superReadOnly bool, err error) {
+	return d.ReadOnlyContext(context.Background())
+}
+
+//同ReadOnly,ctx用于超时和取消控制
+func (d *DBHandler) ReadOnlyContext(ctx context.Context) (readOnly, superReadOnly bool, err error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	version, err := d.GetVersionContext(ctx)
+	if err != nil {
+		return false, false, err
+	}
+	if !versionAtLeast(version, superReadOnlyVersion) {
+		err = d.conn.QueryRowContext(ctx, "SELECT @@GLOBAL.read_only").Scan(&readOnly)
+		return readOnly, false, err
+	}
+	err = d.conn.QueryRowContext(ctx, "SELECT @@GLOBAL.read_only,@@GLOBAL.super_read_only").Scan(&readOnly, &superReadOnly)
+	return readOnly, superReadOnly, err
+}
+
+//设置实例只读,支持super_read_only时同时设置super_read_only,关闭只读时同时关闭两者
+func (d *DBHandler) SetReadOnly(readOnly bool) error {
+	return d.SetReadOnlyContext(context.Background(), readOnly)
+}
+
+//同SetReadOnly,ctx用于超时和取消控制
+func (d *DBHandler) SetReadOnlyContext(ctx context.Context, readOnly bool) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	version, err := d.GetVersionContext(ctx)
+	if err != nil {
+		return err
+	}
+	return d.setReadOnly(ctx, readOnly, readOnly && versionAtLeast(version, superReadOnlyVersion))
+}
+
+//开启super_read_only会同时开启read_only,关闭read_only会同时关闭super_read_only
+func (d *DBHandler) setReadOnly(ctx context.Context, readOnly, superReadOnly bool) error {
+	if superReadOnly {
+		return d.SetVariableContext(ctx, "super_read_only", "ON")
+	}
+	if readOnly {
+		//可能需要从super_read_only恢复为只有read_only
+		version, err := d.GetVersionContext(ctx)
+		if err != nil {
+			return err
+		}
+		if versionAtLeast(version, superReadOnlyVersion) {
+			if err := d.SetVariableContext(ctx, "super_read_only", "OFF"); err != nil {
+				return err
+			}
+		}
+		return d.SetVariableContext(ctx, "read_only", "ON")
+	}
+	return d.SetVariableContext(ctx, "read_only", "OFF")
+}
+
+//杀掉客户端连接,保留复制相关的Binlog Dump线程
+func (d *DBHandler) killClientSessions(ctx context.Context) error {
+	sessions, err := d.ListSessionsContext(ctx, nil)
+	if err != nil {
+		return err
+	}
+	ids := make([]int, 0, len(sessions))
+	for _, s := range sessions {
+		if !strings.HasPrefix(s.Command, "Binlog Dump") && s.Command != "Daemon" {
+			ids = append(ids, s.Id)
+		}
+	}
+	//Ids为空时会匹配所有会话
+	if len(ids) == 0 {
+		return nil
+	}
+	results, err := d.KillSessionsContext(ctx, &SessionFilter{Ids: ids}, false)
+	if err != nil {
+		return err
+	}
+	//会话在查询之后自己退出时返回Unknown thread id,不当作错误
+	for _, r := range results {
+		if mysqlErr, ok := errors.Cause(r.Err).(*mysql.MySQLError); ok && mysqlErr.Number == 1094 {
+			r.Err = nil
+		}
+	}
+	return killResultsError(results)
+}
+
+//计划一次主从切换,原主库和候选主库都必须可用,候选主库必须是原主库的从库
+//切换步骤:
+//	1.原主库开启只读
+//	2.杀掉原主库上的客户端连接
+//	3.等待候选主库执行完原主库上的所有事务
+//	4.候选主库停止复制
+//	5.其他从库指向候选主库
+//	6.RepointPrimary为true时原主库作为候选主库的从库
+//	7.候选主库清除复制配置
+//	8.候选主库关闭只读
+//返回的计划可以先通过String查看(dry-run),再调用Execute执行
+func PlanSwitchover(opts *SwitchoverOptions) (*SwitchoverPlan, error) {
+	return PlanSwitchoverContext(context.Background(), opts)
+}
+
+//同PlanSwitchover,ctx用于超时和取消控制
+func PlanSwitchoverContext(ctx context.Context, opts *SwitchoverOptions) (*SwitchoverPlan, error) {
+	if err := opts.normalize(); err != nil {
+		return nil, err
+	}
+	primary, candidate := opts.Primary, opts.Candidate
+	if primary == nil || primary.Handler == nil || candidate == nil || candidate.Handler == nil {
+		return nil, errors.New("switchover需要指定原主库和候选主库")
+	}
+	//候选主库必须是原主库的从库并且没有原主库没有的事务
+	primaryNode, _, err := inspectTopologyNode(ctx, primary.Handler)
+	if err != nil {
+		return nil, err
+	}
+	primaryUUID := primaryNode.ServerUUID
+	status, err := candidate.Handler.ShowReplicaChannelStatusContext(ctx, opts.Channel)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(status.SourceUUID, primaryUUID) {
+		return nil, errors.New(fmt.Sprintf("候选主库%s的主库uuid为%s,不是%s(%s)", candidate, status.SourceUUID, primary, primaryUUID))
+	}
+	errant, err := candidate.Handler.CheckErrantTransactionsContext(ctx, primary.Handler)
+	if err != nil {
+		return nil, err
+	}
+	if !errant.IsEmpty() {
+		return nil, errors.New(fmt.Sprintf("候选主库%s存在原主库没有的事务:%s", candidate, errant))
+	}
+	readOnly, superReadOnly, err := primary.Handler.ReadOnlyContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &SwitchoverPlan{Kind: "switchover", Primary: primary, Candidate: candidate, logf: opts.Logger}
+	plan.Steps = append(plan.Steps,
+		&SwitchoverStep{
+			Name: fmt.Sprintf("原主库%s开启只读", primary),
+			do: func(ctx context.Context) error {
+				return primary.Handler.SetReadOnlyContext(ctx, true)
+			},
+			undo: func(ctx context.Context) error {
+				return primary.Handler.setReadOnly(ctx, readOnly, superReadOnly)
+			},
+		},
+		&SwitchoverStep{
+			Name: fmt.Sprintf("杀掉原主库%s上的客户端连接", primary),
+			do: func(ctx context.Context) error {
+				return primary.Handler.killClientSessions(ctx)
+			},
+		},
+		&SwitchoverStep{
+			Name: fmt.Sprintf("等待候选主库%s执行完原主库上的所有事务", candidate),
+			do: func(ctx context.Context) error {
+				executed, err := primary.Handler.GtidExecutedContext(ctx)
+				if err != nil {
+					return err
+				}
+				return candidate.Handler.WaitForExecutedGtidSetContext(ctx, executed, opts.CatchupTimeout)
+			},
+		},
+		&SwitchoverStep{
+			Name: fmt.Sprintf("候选主库%s停止复制", candidate),
+			do: func(ctx context.Context) error {
+				return candidate.Handler.StopReplicaContext(ctx, opts.Channel, "")
+			},
+			undo: func(ctx context.Context) error {
+				return candidate.Handler.StartReplicaContext(ctx, opts.Channel, "")
+			},
+		},
+	)
+	for _, r := range opts.Replicas {
+		r := r
+		if r == candidate {
+			continue
+		}
+		plan.Steps = append(plan.Steps, &SwitchoverStep{
+			Name: fmt.Sprintf("从库%s指向候选主库%s", r, candidate),
+			do: func(ctx context.Context) error {
+				return opts.repoint(ctx, r, candidate)
+			},
+			undo: func(ctx context.Context) error {
+				return opts.repoint(ctx, r, primary)
+			},
+		})
+	}
+	if opts.RepointPrimary {
+		plan.Steps = append(plan.Steps, &SwitchoverStep{
+			Name: fmt.Sprintf("原主库%s作为候选主库%s的从库", primary, candidate),
+			do: func(ctx context.Context) error {
+				if err := primary.Handler.ConfigureReplicaContext(ctx, opts.replicaConfig(candidate)); err != nil {
+					return err
+				}
+				return primary.Handler.StartReplicaContext(ctx, opts.Channel, "")
+			},
+			undo: func(ctx context.Context) error {
+				if err := primary.Handler.StopReplicaContext(ctx, opts.Channel, ""); err != nil {
+					return err
+				}
+				return primary.Handler.ResetReplicaContext(ctx, opts.Channel, true)
+			},
+		})
+	}
+	plan.Steps = append(plan.Steps, promoteSteps(opts, primary, candidate, candidate.String())...)
+	return plan, nil
+}
+
+//候选主库清除复制配置并关闭只读,candidateName用于步骤名称,failover时候选主库在执行过程中才确定
+func promoteSteps(opts *SwitchoverOptions, primary, candidate *SwitchoverInstance, candidateName string) []*SwitchoverStep {
+	resetStep := &SwitchoverStep{
+		Name: fmt.Sprintf("候选主库%s清除复制配置", candidateName),
+		do: func(ctx context.Context) error {
+			return candidate.Handler.ResetReplicaContext(ctx, opts.Channel, true)
+		},
+	}
+	//原主库地址未知时无法恢复复制配置
+	if primary != nil && primary.Host != "" {
+		resetStep.undo = func(ctx context.Context) error {
+			return candidate.Handler.ConfigureReplicaContext(ctx, opts.replicaConfig(primary))
+		}
+	}
+	return []*SwitchoverStep{
+		resetStep,
+		{
+			Name: fmt.Sprintf("候选主库%s关闭只读", candidateName),
+			do: func(ctx context.Context) error {
+				return candidate.Handler.SetReadOnlyContext(ctx, false)
+			},
+			undo: func(ctx context.Context) error {
+				return candidate.Handler.SetReadOnlyContext(ctx, true)
+			},
+		},
+	}
+}
+
+//选择GTID集合包含其他所有集合的下标,多个集合相同时选择第一个
+//不存在包含其他所有集合的集合时说明从库之间存在互相缺少的事务,返回错误
+func chooseMostAdvanced(sets []gtid.Set) (int, error) {
+	if len(sets) == 0 {
+		return -1, errors.New("没有可选择的从库")
+	}
+	for i, set := range sets {
+		containsAll := true
+		for j, other := range sets {
+			if i != j && !set.Contains(other) {
+				containsAll = false
+				break
+			}
+		}
+		if containsAll {
+			return i, nil
+		}
+	}
+	return -1, errors.New("没有一个从库包含其他所有从库的事务,需要人工处理")
+}
+
+//读取每个从库最终会执行的事务,即Executed_Gtid_Set和Retrieved_Gtid_Set的并集
+func receivedGtidSets(ctx context.Context, replicas []*SwitchoverInstance, channel string) ([]gtid.Set, error) {
+	received := make([]gtid.Set, 0, len(replicas))
+	for _, r := range replicas {
+		status, err := r.Handler.ShowReplicaChannelStatusContext(ctx, channel)
+		if err != nil {
+			return nil, errors.Wrap(err, r.String())
+		}
+		executed, err := gtid.Parse(status.ExecutedGtidSet)
+		if err != nil {
+			return nil, err
+		}
+		retrieved, err := gtid.Parse(status.RetrievedGtidSet)
+		if err != nil {
+			return nil, err
+		}
+		received = append(received, executed.Union(retrieved))
+	}
+	return received, nil
+}
+
+//计划一次故障切换,原主库不可用
+//候选主库为空时选择已接收事务(Executed_Gtid_Set和Retrieved_Gtid_Set的并集)最多的从库
+//从库停止IO线程之前仍然会接收事务,所以候选主库的选择和检查都在执行时停止IO线程之后进行
+//切换步骤:
+//	1.所有从库停止IO线程
+//	2.读取所有从库已经接收的事务,选择候选主库,并检查其他从库没有候选主库没有的事务
+//	3.等待所有从库应用完已经接收的事务
+//	4.候选主库停止复制
+//	5.其他从库指向候选主库
+//	6.候选主库清除复制配置
+//	7.候选主库关闭只读
+func PlanFailover(opts *SwitchoverOptions) (*SwitchoverPlan, error) {
+	return PlanFailoverContext(context.Background(), opts)
+}
+
+//同PlanFailover,ctx用于超时和取消控制
+func PlanFailoverContext(ctx context.Context, opts *SwitchoverOptions) (*SwitchoverPlan, error) {
+	if err := opts.normalize(); err != nil {
+		return nil, err
+	}
+	replicas := append([]*SwitchoverInstance{}, opts.Replicas...)
+	if opts.Candidate != nil {
+		if opts.Candidate.Handler == nil {
+			return nil, errors.New("候选主库的Handler不能为空")
+		}
+		found := false
+		for _, r := range replicas {
+			found = found || r == opts.Candidate
+		}
+		if !found {
+			replicas = append(replicas, opts.Candidate)
+		}
+	}
+	if len(replicas) == 0 {
+		return nil, errors.New("failover至少需要一个从库")
+	}
+	//提前检查所有从库都可以访问,避免执行时才发现
+	for _, r := range replicas {
+		if _, err := r.Handler.ShowReplicaChannelStatusContext(ctx, opts.Channel); err != nil {
+			return nil, errors.Wrap(err, r.String())
+		}
+	}
+
+	plan := &SwitchoverPlan{Kind: "failover", Primary: opts.Primary, Candidate: opts.Candidate, logf: opts.Logger}
+	//以下状态在执行时确定,candidate在选择候选主库后填充,供后续步骤使用
+	var (
+		received     []gtid.Set
+		chosen       = -1
+		candidate    = &SwitchoverInstance{}
+		repointed    []*SwitchoverInstance
+		chooseAction = "检查"
+	)
+	if opts.Candidate == nil {
+		chooseAction = "选择"
+	}
+	candidateName := plan.candidateName()
+	plan.Steps = append(plan.Steps,
+		&SwitchoverStep{
+			Name: "所有从库停止IO线程",
+			do: func(ctx context.Context) error {
+				for _, r := range replicas {
+					if err := r.Handler.StopReplicaContext(ctx, opts.Channel, ReplicaIOThread); err != nil {
+						return errors.Wrap(err, r.String())
+					}
+				}
+				return nil
+			},
+			undo: func(ctx context.Context) error {
+				for _, r := range replicas {
+					if err := r.Handler.StartReplicaContext(ctx, opts.Channel, ReplicaIOThread); err != nil {
+						return errors.Wrap(err, r.String())
+					}
+				}
+				return nil
+			},
+		},
+		&SwitchoverStep{
+			Name: fmt.Sprintf("读取所有从库已经接收的事务,%s候选主库%s", chooseAction, candidateName),
+			do: func(ctx context.Context) error {
+				var err error
+				if received, err = receivedGtidSets(ctx, replicas, opts.Channel); err != nil {
+					return err
+				}
+				chosen = -1
+				for i, r := range replicas {
+					if r == opts.Candidate {
+						chosen = i
+					}
+				}
+				if chosen < 0 {
+					if chosen, err = chooseMostAdvanced(received); err != nil {
+						return err
+					}
+					opts.Logger("[failover] 选择%s作为新主库,GTID集合:%s", replicas[chosen], received[chosen])
+				}
+				for i, r := range replicas {
+					if missing := received[i].Subtract(received[chosen]); i != chosen && !missing.IsEmpty() {
+						return errors.New(fmt.Sprintf("从库%s存在候选主库%s没有的事务:%s", r, replicas[chosen], missing))
+					}
+				}
+				*candidate = *replicas[chosen]
+				plan.Candidate = replicas[chosen]
+				return nil
+			},
+		},
+		&SwitchoverStep{
+			Name: "等待所有从库应用完已经接收的事务",
+			do: func(ctx context.Context) error {
+				for i, r := range replicas {
+					if err := r.Handler.WaitForExecutedGtidSetContext(ctx, received[i], opts.CatchupTimeout); err != nil {
+						return errors.Wrap(err, r.String())
+					}
+				}
+				return nil
+			},
+		},
+		&SwitchoverStep{
+			Name: fmt.Sprintf("候选主库%s停止复制", candidateName),
+			do: func(ctx context.Context) error {
+				return candidate.Handler.StopReplicaContext(ctx, opts.Channel, "")
+			},
+			undo: func(ctx context.Context) error {
+				return candidate.Handler.StartReplicaContext(ctx, opts.Channel, "")
+			},
+		},
+	)
+	//候选主库在执行时才确定,所以其他从库在一个步骤中重新指向
+	//Execute只回滚已经完成的步骤,该步骤中途失败时自己把已经处理过的从库指回原主库
+	repointStep := &SwitchoverStep{Name: fmt.Sprintf("其他从库指向候选主库%s", candidateName)}
+	if opts.Primary != nil && opts.Primary.Host != "" {
+		repointStep.undo = func(ctx context.Context) error {
+			for _, r := range repointed {
+				if err := opts.repoint(ctx, r, opts.Primary); err != nil {
+					return errors.Wrap(err, r.String())
+				}
+			}
+			return nil
+		}
+	}
+	repointStep.do = func(ctx context.Context) error {
+		repointed = repointed[:0]
+		for i, r := range replicas {
+			if i == chosen {
+				continue
+			}
+			repointed = append(repointed, r)
+			if err := opts.repoint(ctx, r, candidate); err != nil {
+				err = errors.Wrap(err, r.String())
+				if repointStep.undo != nil {
+					if undoErr := repointStep.undo(context.Background()); undoErr != nil {
+						err = errors.Wrap(err, "从库指回原主库失败:"+undoErr.Error())
+					}
+				}
+				return err
+			}
+		}
+		return nil
+	}
+	plan.Steps = append(plan.Steps, repointStep)
+	plan.Steps = append(plan.Steps, promoteSteps(opts, opts.Primary, candidate, candidateName)...)
+	return plan, nil
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/wencycool/dbfree/gtid"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChooseMostAdvanced(t *testing.T) {
+	const uuid = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	sets := []gtid.Set{
+		gtid.MustParse(uuid + ":1-10"),
+		gtid.MustParse(uuid + ":1-12"),
+		gtid.MustParse(uuid + ":1-12"),
+	}
+	if i, err := chooseMostAdvanced(sets); err != nil || i != 1 {
+		t.Errorf("chooseMostAdvanced()=%d,%v,want 1", i, err)
+	}
+	//两个从库互相缺少事务
+	sets = append(sets, gtid.MustParse(uuid+":1-11,4e11fa47-71ca-11e1-9e33-c80aa9429562:1"))
+	if _, err := chooseMostAdvanced(sets); err == nil {
+		t.Errorf("diverged replicas should fail")
+	}
+	if _, err := chooseMostAdvanced(nil); err == nil {
+		t.Errorf("empty replicas should fail")
+	}
+}
+
+func TestSwitchoverPlan_Execute(t *testing.T) {
+	var (
+		calls []string
+		logs  []string
+	)
+	step := func(name string, fail, undoable bool) *SwitchoverStep {
+		s := &SwitchoverStep{Name: name, do: func(ctx context.Context) error {
+			calls = append(calls, "do "+name)
+			if fail {
+				return errors.New("boom")
+			}
+			return nil
+		}}
+		if undoable {
+			s.undo = func(ctx context.Context) error {
+				calls = append(calls, "undo "+name)
+				return nil
+			}
+		}
+		return s
+	}
+	plan := &SwitchoverPlan{
+		Kind:      "switchover",
+		Primary:   &SwitchoverInstance{Host: "db1", Port: 3306},
+		Candidate: &SwitchoverInstance{Host: "db2", Port: 3306},
+		Steps:     []*SwitchoverStep{step("a", false, true), step("b", false, false), step("c", false, true), step("d", true, true)},
+		logf: func(format string, v ...interface{}) {
+			logs = append(logs, fmt.Sprintf(format, v...))
+		},
+	}
+	want := "switchover: db1:3306 -> db2:3306\n1. a\n2. b (不可回滚)\n3. c\n4. d\n"
+	if got := plan.String(); got != want {
+		t.Errorf("plan:\n%s\nwant:\n%s", got, want)
+	}
+	err := plan.Execute()
+	if err == nil || !strings.Contains(err.Error(), "d: boom") {
+		t.Errorf("unexpected error:%v", err)
+	}
+	if want := []string{"do a", "do b", "do c", "do d", "undo c", "undo a"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls=%v,want %v", calls, want)
+	}
+	if len(logs) == 0 || !strings.Contains(logs[len(logs)-1], "rollback 1/4") {
+		t.Errorf("unexpected logs:%v", logs)
+	}
+
+	//全部成功时不回滚
+	calls = nil
+	plan.Steps = plan.Steps[:3]
+	plan.Primary = nil
+	if err := plan.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 3 || !strings.Contains(logs[len(logs)-1], "unknown切换到db2:3306成功") {
+		t.Errorf("calls=%v,logs=%v", calls, logs)
+	}
+}
@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//表的信息,来自information_schema.TABLES
+type TableInfo struct {
+	Schema            string
+	Name              string
+	Engine            string
+	RowFormat         string
+	Rows              int64     //估算的行数
+	DataSize          int64     //数据大小(字节)
+	IndexSize         int64     //索引大小(字节)
+	DataFree          int64     //已分配未使用的空间(字节)
+	AutoIncrement     uint64    //下一个自增值,没有自增列时为0
+	AutoIncrementType string    //自增列的类型,如int unsigned,没有自增列时为空
+	CreateTime        time.Time //创建时间
+	UpdateTime        time.Time //最后更新时间,InnoDB在重启后为空
+	HasPrimaryKey     bool
+}
+
+//自增列类型能够存储的最大值,无法识别时返回0
+func autoIncrementMax(columnType string) uint64 {
+	fields := strings.Fields(strings.ToLower(columnType))
+	if len(fields) == 0 {
+		return 0
+	}
+	//去掉显示宽度,如int(11)
+	baseType := fields[0]
+	if i := strings.Index(baseType, "("); i >= 0 {
+		baseType = baseType[:i]
+	}
+	unsigned := false
+	for _, f := range fields[1:] {
+		if f == "unsigned" {
+			unsigned = true
+		}
+	}
+	var bits uint
+	switch baseType {
+	case "tinyint":
+		bits = 8
+	case "smallint":
+		bits = 16
+	case "mediumint":
+		bits = 24
+	case "int", "integer":
+		bits = 32
+	case "bigint":
+		bits = 64
+	default:
+		return 0
+	}
+	if unsigned {
+		if bits == 64 {
+			return math.MaxUint64
+		}
+		return 1<<bits - 1
+	}
+	return 1<<(bits-1) - 1
+}
+
+//自增值剩余可用的数量,没有自增列时返回0
+func (t *TableInfo) AutoIncrementHeadroom() uint64 {
+	max := autoIncrementMax(t.AutoIncrementType)
+	if max == 0 || t.AutoIncrement > max {
+		return 0
+	}
+	return max - t.AutoIncrement
+}
+
+//自增值已经使用的比例,取值0到1,没有自增列时返回0
+func (t *TableInfo) AutoIncrementUsage() float64 {
+	max := autoIncrementMax(t.AutoIncrementType)
+	if max == 0 || t.AutoIncrement == 0 {
+		return 0
+	}
+	return float64(t.AutoIncrement) / float64(max)
+}
+
+//查看数据库下所有表的存储信息,不包括视图
+func (d *DBHandler) ListTables(db string) ([]*TableInfo, error) {
+	return d.ListTablesContext(context.Background(), db)
+}
+
+//同ListTables,ctx用于超时和取消控制
+func (d *DBHandler) ListTablesContext(ctx context.Context, db string) ([]*TableInfo, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	listTablesSQL := "SELECT t.TABLE_NAME,IFNULL(t.ENGINE,''),IFNULL(t.ROW_FORMAT,''),IFNULL(t.TABLE_ROWS,0)," +
+		"IFNULL(t.DATA_LENGTH,0),IFNULL(t.INDEX_LENGTH,0),IFNULL(t.DATA_FREE,0),t.AUTO_INCREMENT,t.CREATE_TIME,t.UPDATE_TIME," +
+		"(SELECT COUNT(*) FROM information_schema.TABLE_CONSTRAINTS c WHERE c.TABLE_SCHEMA=t.TABLE_SCHEMA AND c.TABLE_NAME=t.TABLE_NAME AND c.CONSTRAINT_TYPE='PRIMARY KEY')," +
+		"(SELECT c.COLUMN_TYPE FROM information_schema.COLUMNS c WHERE c.TABLE_SCHEMA=t.TABLE_SCHEMA AND c.TABLE_NAME=t.TABLE_NAME AND c.EXTRA LIKE '%auto_increment%' LIMIT 1) " +
+		"FROM information_schema.TABLES t WHERE t.TABLE_SCHEMA=? AND t.TABLE_TYPE='BASE TABLE' ORDER BY t.TABLE_NAME"
+	rows, err := d.conn.QueryContext(ctx, listTablesSQL, db)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var (
+		tables        = make([]*TableInfo, 0)
+		autoIncrement sql.NullString
+		createTime    sql.NullTime
+		updateTime    sql.NullTime
+		pkCount       int
+		autoIncType   sql.NullString
+	)
+	for rows.Next() {
+		t := &TableInfo{Schema: db}
+		if err := rows.Scan(&t.Name, &t.Engine, &t.RowFormat, &t.Rows, &t.DataSize, &t.IndexSize, &t.DataFree,
+			&autoIncrement, &createTime, &updateTime, &pkCount, &autoIncType); err != nil {
+			return nil, err
+		}
+		//AUTO_INCREMENT为bigint unsigned,可能超出int64的范围
+		if autoIncrement.Valid {
+			t.AutoIncrement, _ = strconv.ParseUint(autoIncrement.String, 10, 64)
+		}
+		t.AutoIncrementType = autoIncType.String
+		t.CreateTime = createTime.Time
+		t.UpdateTime = updateTime.Time
+		t.HasPrimaryKey = pkCount > 0
+		tables = append(tables, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAutoIncrementMax(t *testing.T) {
+	cases := map[string]uint64{
+		"tinyint":             127,
+		"tinyint(4) unsigned": 255,
+		"smallint":            32767,
+		"mediumint unsigned":  16777215,
+		"int(11)":             2147483647,
+		"int unsigned":        4294967295,
+		"bigint(20)":          math.MaxInt64,
+		"bigint unsigned":     math.MaxUint64,
+		"decimal(10,0)":       0,
+		"":                    0,
+	}
+	for columnType, want := range cases {
+		if got := autoIncrementMax(columnType); got != want {
+			t.Errorf("autoIncrementMax(%q)=%d,want %d", columnType, got, want)
+		}
+	}
+}
+
+func TestTableInfo_AutoIncrement(t *testing.T) {
+	table := &TableInfo{AutoIncrement: 2147483000, AutoIncrementType: "int(11)"}
+	if got := table.AutoIncrementHeadroom(); got != 647 {
+		t.Errorf("AutoIncrementHeadroom()=%d,want 647", got)
+	}
+	if got := table.AutoIncrementUsage(); got < 0.99 || got > 1 {
+		t.Errorf("AutoIncrementUsage()=%f,want about 1", got)
+	}
+	table = &TableInfo{}
+	if table.AutoIncrementHeadroom() != 0 || table.AutoIncrementUsage() != 0 {
+		t.Errorf("table without auto increment column should have no headroom")
+	}
+}
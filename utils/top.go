@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+)
+
+//会话的排序方式
+const (
+	SessionSortTime    = "time"
+	SessionSortId      = "id"
+	SessionSortUser    = "user"
+	SessionSortDB      = "db"
+	SessionSortCommand = "command"
+)
+
+//按照指定字段对会话排序,by不合法时按运行时间排序,字段相同时按id升序
+func SortSessions(sessions []*Session, by string, desc bool) {
+	less := func(a, b *Session) bool {
+		return a.Time < b.Time
+	}
+	switch by {
+	case SessionSortId:
+		less = func(a, b *Session) bool {
+			return a.Id < b.Id
+		}
+	case SessionSortUser:
+		less = func(a, b *Session) bool {
+			return a.User < b.User
+		}
+	case SessionSortDB:
+		less = func(a, b *Session) bool {
+			return a.DB < b.DB
+		}
+	case SessionSortCommand:
+		less = func(a, b *Session) bool {
+			return a.Command < b.Command
+		}
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		a, b := sessions[i], sessions[j]
+		if less(a, b) {
+			return !desc
+		}
+		if less(b, a) {
+			return desc
+		}
+		return a.Id < b.Id
+	})
+}
+
+//InnoDB缓冲池命中率,即逻辑读中不需要读磁盘的比例,这段时间内没有逻辑读时ok为false
+func (d *StatusDelta) BufferPoolHitRatio() (ratio float64, ok bool) {
+	requests := d.Rates["Innodb_buffer_pool_read_requests"]
+	if requests <= 0 {
+		return 0, false
+	}
+	ratio = 1 - d.Rates["Innodb_buffer_pool_reads"]/requests
+	if ratio < 0 {
+		ratio = 0
+	}
+	return ratio, true
+}
+
+//top的一次采样结果
+type TopSample struct {
+	Time     time.Time
+	Status   *StatusSnapshot
+	Delta    *StatusDelta //与上一次采样之间的变化,第一次采样或者实例重启后为nil
+	Sessions []*Session   //活跃会话,不包含Sleep、后台线程以及top自身的会话
+	Replica  bool         //是否为从库
+	Lag      *ReplicaLag  //复制延迟,非从库或者延迟未知时为nil
+	LagErr   error        //从库的复制延迟获取失败的原因
+}
+
+//周期性采集实例的状态、会话和复制延迟,用于类似top的实时监控
+type TopMonitor struct {
+	d         *DBHandler
+	heartbeat HeartbeatOptions
+	prev      *StatusSnapshot
+}
+
+//heartbeat为计算复制延迟时使用的心跳表,不指定时使用默认值
+func NewTopMonitor(d *DBHandler, heartbeat ...HeartbeatOptions) *TopMonitor {
+	return &TopMonitor{d: d, heartbeat: *mergeHeartbeatOptions(heartbeat)}
+}
+
+//采集一次,与上一次采样计算每秒的变化
+func (m *TopMonitor) Sample(ctx context.Context) (*TopSample, error) {
+	status, err := m.d.GlobalStatusSnapshotContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sample := &TopSample{Time: status.Time, Status: status}
+	if m.prev != nil {
+		//实例重启时Diff失败,从本次采样重新开始计算
+		if delta, err := Diff(m.prev, status); err == nil {
+			sample.Delta = delta
+		}
+	}
+	m.prev = status
+	sessions, err := m.d.ListSessionsContext(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	sample.Sessions = make([]*Session, 0, len(sessions))
+	for _, s := range sessions {
+		if isIdleSession(s) || s.Info == listSessionsSQL {
+			continue
+		}
+		sample.Sessions = append(sample.Sessions, s)
+	}
+	replicaStatus, err := m.d.ShowReplicaStatusContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if sample.Replica = len(replicaStatus) > 0; sample.Replica {
+		sample.Lag, sample.LagErr = m.d.ReplicationLagContext(ctx, m.heartbeat)
+	}
+	return sample, nil
+}
+
+//空闲会话以及后台线程
+func isIdleSession(s *Session) bool {
+	switch {
+	case strings.EqualFold(s.Command, "Sleep"), strings.EqualFold(s.Command, "Daemon"):
+		return true
+	case s.User == "system user", s.User == "event_scheduler":
+		return true
+	}
+	return false
+}
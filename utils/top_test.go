@@ -0,0 +1,50 @@
+package utils
+
+import "testing"
+
+func TestSortSessions(t *testing.T) {
+	sessions := []*Session{
+		{Id: 3, User: "app", Time: 10},
+		{Id: 1, User: "root", Time: 30},
+		{Id: 2, User: "app", Time: 10},
+	}
+	ids := func() []int {
+		result := make([]int, 0, len(sessions))
+		for _, s := range sessions {
+			result = append(result, s.Id)
+		}
+		return result
+	}
+	tests := []struct {
+		by   string
+		desc bool
+		want []int
+	}{
+		{SessionSortTime, true, []int{1, 2, 3}},
+		{SessionSortTime, false, []int{2, 3, 1}},
+		{SessionSortId, false, []int{1, 2, 3}},
+		{SessionSortUser, true, []int{1, 2, 3}},
+		{"unknown", false, []int{2, 3, 1}},
+	}
+	for _, tt := range tests {
+		SortSessions(sessions, tt.by, tt.desc)
+		got := ids()
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("SortSessions(%s,%v)=%v,want %v", tt.by, tt.desc, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestBufferPoolHitRatio(t *testing.T) {
+	delta := &StatusDelta{Rates: map[string]float64{"Innodb_buffer_pool_read_requests": 1000, "Innodb_buffer_pool_reads": 10}}
+	if ratio, ok := delta.BufferPoolHitRatio(); !ok || ratio != 0.99 {
+		t.Errorf("unexpected ratio:%v,%v", ratio, ok)
+	}
+	delta = &StatusDelta{Rates: map[string]float64{"Innodb_buffer_pool_read_requests": 0}}
+	if _, ok := delta.BufferPoolHitRatio(); ok {
+		t.Errorf("expect no ratio without read requests")
+	}
+}
@@ -0,0 +1,499 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//连接拓扑中其他实例的方法,host和port来自复制状态或者从库注册的信息
+type Connector func(host string, port int) (*DBHandler, error)
+
+//使用相同的账号和连接选项连接所有实例
+func NewConnector(user, password string, opts ...ConnOptions) Connector {
+	return func(host string, port int) (*DBHandler, error) {
+		dbHandler, err := NewDBHandler(host, port, user, password, opts...)
+		if err != nil {
+			return nil, err
+		}
+		if err := dbHandler.ping(); err != nil {
+			dbHandler.Close()
+			return nil, err
+		}
+		return dbHandler, nil
+	}
+}
+
+//复制拓扑中的一个实例
+type TopologyNode struct {
+	Address      string   //host:port,起始实例使用report_host或hostname
+	Aliases      []string `json:",omitempty"` //其他指向该实例的地址
+	ServerId     int
+	ServerUUID   string
+	Version      string
+	ReadOnly     bool
+	GtidExecuted string
+	Lag          int64  //作为从库时所有通道的最大延迟秒数,-1表示未知,不是从库时为0
+	Error        string `json:",omitempty"` //无法连接时的错误信息
+}
+
+//复制拓扑中的一条复制关系
+type TopologyLink struct {
+	Source     string //主库地址,对应TopologyNode.Address
+	Replica    string //从库地址,对应TopologyNode.Address
+	Channel    string
+	IORunning  string
+	SQLRunning string
+	Lag        int64  //延迟秒数,-1表示未知
+	LastError  string `json:",omitempty"`
+}
+
+//复制拓扑
+type Topology struct {
+	Nodes []*TopologyNode
+	Links []*TopologyLink
+}
+
+//根据地址查找实例,地址可以是别名
+func (t *Topology) Node(addr string) *TopologyNode {
+	for _, n := range t.Nodes {
+		if n.Address == addr {
+			return n
+		}
+		for _, alias := range n.Aliases {
+			if alias == addr {
+				return n
+			}
+		}
+	}
+	return nil
+}
+
+//实例作为主库时的复制关系
+func (t *Topology) ReplicaLinks(addr string) []*TopologyLink {
+	links := make([]*TopologyLink, 0)
+	for _, l := range t.Links {
+		if l.Source == addr {
+			links = append(links, l)
+		}
+	}
+	return links
+}
+
+//实例作为从库时的复制关系
+func (t *Topology) SourceLinks(addr string) []*TopologyLink {
+	links := make([]*TopologyLink, 0)
+	for _, l := range t.Links {
+		if l.Replica == addr {
+			links = append(links, l)
+		}
+	}
+	return links
+}
+
+//下游从库的候选地址,连接后需要校验server_id
+type replicaCandidate struct {
+	serverId int      //为0时不校验
+	addrs    []string //可能的地址,按顺序尝试
+}
+
+//根据SHOW REPLICAS以及Binlog Dump线程推断从库地址
+//从库设置了report_host时直接使用,否则使用Binlog Dump线程的客户端地址加上从库上报的端口
+//SHOW SLAVE HOSTS和SHOW REPLICAS的列名大小写不同,如Server_id和Server_Id,统一忽略大小写
+func replicaCandidates(replicaHosts []map[string]string, dumpSessions []*Session) []*replicaCandidate {
+	clientHosts := make([]string, 0, len(dumpSessions))
+	seen := make(map[string]bool, 0)
+	for _, s := range dumpSessions {
+		if h := s.ClientHost(); h != "" && !seen[h] {
+			seen[h] = true
+			clientHosts = append(clientHosts, h)
+		}
+	}
+	candidates := make([]*replicaCandidate, 0, len(replicaHosts))
+	for _, rawRow := range replicaHosts {
+		row := make(map[string]string, len(rawRow))
+		for k, v := range rawRow {
+			row[strings.ToLower(k)] = v
+		}
+		c := new(replicaCandidate)
+		c.serverId, _ = strconv.Atoi(row["server_id"])
+		port, _ := strconv.Atoi(row["port"])
+		if port == 0 {
+			port = 3306
+		}
+		if host := row["host"]; host != "" {
+			c.addrs = append(c.addrs, net.JoinHostPort(host, strconv.Itoa(port)))
+		}
+		for _, h := range clientHosts {
+			if addr := net.JoinHostPort(h, strconv.Itoa(port)); len(c.addrs) == 0 || c.addrs[0] != addr {
+				c.addrs = append(c.addrs, addr)
+			}
+		}
+		if len(c.addrs) > 0 {
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates
+}
+
+//发现复制拓扑时的状态
+type topologyWalker struct {
+	ctx       context.Context
+	connect   Connector
+	topo      *Topology
+	byAddr    map[string]*TopologyNode
+	byUUID    map[string]*TopologyNode
+	attempted map[string]*TopologyNode //已经尝试连接过的地址,连接失败时为nil
+	queue     []*replicaCandidate
+}
+
+//从当前实例开始发现复制拓扑
+//向上通过SHOW REPLICA STATUS查找主库,向下通过SHOW REPLICAS以及Binlog Dump线程查找从库
+//connect用于连接拓扑中的其他实例,无法连接的实例会记录在Error中而不会返回错误
+func (d *DBHandler) DiscoverTopology(connect Connector) (*Topology, error) {
+	return d.DiscoverTopologyContext(context.Background(), connect)
+}
+
+//同DiscoverTopology,ctx用于超时和取消控制,默认的语句超时时间作用于每一个实例上的每一次查询
+func (d *DBHandler) DiscoverTopologyContext(ctx context.Context, connect Connector) (*Topology, error) {
+	w := &topologyWalker{
+		ctx:       ctx,
+		connect:   connect,
+		topo:      new(Topology),
+		byAddr:    make(map[string]*TopologyNode, 0),
+		byUUID:    make(map[string]*TopologyNode, 0),
+		attempted: make(map[string]*TopologyNode, 0),
+	}
+	node, addr, err := inspectTopologyNode(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	node.Address = addr
+	w.addNode(node)
+	if err := w.expand(node, d); err != nil {
+		return nil, err
+	}
+	for len(w.queue) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		c := w.queue[0]
+		w.queue = w.queue[1:]
+		if err := w.visit(c); err != nil {
+			return nil, err
+		}
+	}
+	//将复制关系中的地址统一成实例的Address
+	for _, l := range w.topo.Links {
+		if n := w.byAddr[l.Source]; n != nil {
+			l.Source = n.Address
+		}
+	}
+	return w.topo, nil
+}
+
+func (w *topologyWalker) addNode(node *TopologyNode) {
+	w.topo.Nodes = append(w.topo.Nodes, node)
+	w.byAddr[node.Address] = node
+	if node.ServerUUID != "" {
+		w.byUUID[node.ServerUUID] = node
+	}
+}
+
+//连接候选地址并加入拓扑,所有地址都无法连接时加入一个带有错误信息的实例
+func (w *topologyWalker) visit(c *replicaCandidate) error {
+	for _, addr := range c.addrs {
+		if n, ok := w.byAddr[addr]; ok && (c.serverId == 0 || n.ServerId == c.serverId) {
+			return nil
+		}
+	}
+	var lastErr error
+	for _, addr := range c.addrs {
+		if n, ok := w.attempted[addr]; ok {
+			if n != nil && (c.serverId == 0 || n.ServerId == c.serverId) {
+				return nil
+			}
+			continue
+		}
+		w.attempted[addr] = nil
+		host, portText, err := net.SplitHostPort(addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		port, _ := strconv.Atoi(portText)
+		h, err := w.connect(host, port)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		node, _, err := inspectTopologyNode(w.ctx, h)
+		if err != nil {
+			h.Close()
+			lastErr = err
+			continue
+		}
+		if c.serverId != 0 && node.ServerId != c.serverId {
+			h.Close()
+			lastErr = errors.New(fmt.Sprintf("%s的server_id为%d,期望为%d", addr, node.ServerId, c.serverId))
+			continue
+		}
+		//同一个实例可能通过不同的地址访问到
+		if exist, ok := w.byUUID[node.ServerUUID]; ok {
+			h.Close()
+			exist.Aliases = append(exist.Aliases, addr)
+			w.byAddr[addr] = exist
+			w.attempted[addr] = exist
+			return nil
+		}
+		node.Address = addr
+		w.addNode(node)
+		w.attempted[addr] = node
+		err = w.expand(node, h)
+		h.Close()
+		return err
+	}
+	if _, ok := w.byAddr[c.addrs[0]]; ok {
+		return nil
+	}
+	node := &TopologyNode{Address: c.addrs[0], Lag: -1}
+	if lastErr != nil {
+		node.Error = lastErr.Error()
+	}
+	for _, addr := range c.addrs {
+		w.byAddr[addr] = node
+	}
+	w.topo.Nodes = append(w.topo.Nodes, node)
+	return nil
+}
+
+//查找实例的主库和从库,加入待访问的队列
+func (w *topologyWalker) expand(node *TopologyNode, h *DBHandler) error {
+	statusList, err := h.ShowReplicaStatusContext(w.ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range statusList {
+		sourceAddr := net.JoinHostPort(s.SourceHost, strconv.Itoa(s.SourcePort))
+		link := &TopologyLink{
+			Source:     sourceAddr,
+			Replica:    node.Address,
+			Channel:    s.Channel,
+			IORunning:  s.IORunning,
+			SQLRunning: s.SQLRunning,
+			Lag:        s.SecondsBehind,
+		}
+		switch {
+		case s.LastIOErrno != 0:
+			link.LastError = s.LastIOError
+		case s.LastSQLErrno != 0:
+			link.LastError = s.LastSQLError
+		}
+		w.topo.Links = append(w.topo.Links, link)
+		if s.SecondsBehind < 0 || node.Lag < 0 {
+			node.Lag = -1
+		} else if s.SecondsBehind > node.Lag {
+			node.Lag = s.SecondsBehind
+		}
+		w.queue = append(w.queue, &replicaCandidate{addrs: []string{sourceAddr}})
+	}
+	version, err := h.GetVersionContext(w.ctx)
+	if err != nil {
+		return err
+	}
+	showReplicasSQL := "SHOW SLAVE HOSTS"
+	if versionAtLeast(version, replicaSyntaxVersion) {
+		showReplicasSQL = "SHOW REPLICAS"
+	}
+	replicaHosts, err := h.queryStringMaps(w.ctx, showReplicasSQL)
+	if err != nil {
+		return err
+	}
+	sessions, err := h.ListSessionsContext(w.ctx, nil)
+	if err != nil {
+		return err
+	}
+	dumpSessions := make([]*Session, 0)
+	for _, s := range sessions {
+		if strings.HasPrefix(s.Command, "Binlog Dump") {
+			dumpSessions = append(dumpSessions, s)
+		}
+	}
+	w.queue = append(w.queue, replicaCandidates(replicaHosts, dumpSessions)...)
+	return nil
+}
+
+//读取实例的基本信息,同时返回实例自己上报的地址
+func inspectTopologyNode(ctx context.Context, h *DBHandler) (*TopologyNode, string, error) {
+	ctx, cancel := h.withTimeout(ctx)
+	defer cancel()
+	var (
+		node       = new(TopologyNode)
+		hostname   string
+		reportHost sql.NullString
+		port       int
+		readOnly   int
+	)
+	row := h.conn.QueryRowContext(ctx, "SELECT @@server_id,@@server_uuid,@@version,@@read_only,@@global.gtid_executed,@@hostname,@@report_host,@@port")
+	if err := row.Scan(&node.ServerId, &node.ServerUUID, &node.Version, &readOnly, &node.GtidExecuted, &hostname, &reportHost, &port); err != nil {
+		return nil, "", err
+	}
+	node.ReadOnly = readOnly == 1
+	node.GtidExecuted = strings.Replace(node.GtidExecuted, "\n", "", -1)
+	if reportHost.String != "" {
+		hostname = reportHost.String
+	}
+	return node, net.JoinHostPort(hostname, strconv.Itoa(port)), nil
+}
+
+//将拓扑转换成JSON
+func (t *Topology) JSON() ([]byte, error) {
+	return json.MarshalIndent(t, "", "  ")
+}
+
+//拓扑中没有主库的实例,循环复制时返回第一个实例
+func (t *Topology) roots() []*TopologyNode {
+	roots := make([]*TopologyNode, 0)
+	for _, n := range t.Nodes {
+		if len(t.SourceLinks(n.Address)) == 0 {
+			roots = append(roots, n)
+		}
+	}
+	if len(roots) == 0 && len(t.Nodes) > 0 {
+		roots = append(roots, t.Nodes[0])
+	}
+	return roots
+}
+
+//实例的描述信息
+func (n *TopologyNode) describe() string {
+	if n.Error != "" {
+		return n.Address + " [无法连接:" + n.Error + "]"
+	}
+	desc := fmt.Sprintf("%s [server_id=%d,uuid=%s,version=%s", n.Address, n.ServerId, n.ServerUUID, n.Version)
+	if n.ReadOnly {
+		desc += ",read_only"
+	}
+	return desc + "]"
+}
+
+//复制关系的描述信息
+func (l *TopologyLink) describe() string {
+	desc := make([]string, 0, 4)
+	if l.Channel != "" {
+		desc = append(desc, "channel="+l.Channel)
+	}
+	if l.Lag < 0 {
+		desc = append(desc, "lag=NULL")
+	} else {
+		desc = append(desc, fmt.Sprintf("lag=%ds", l.Lag))
+	}
+	if l.IORunning != "Yes" || l.SQLRunning != "Yes" {
+		desc = append(desc, fmt.Sprintf("io=%s,sql=%s", l.IORunning, l.SQLRunning))
+	}
+	if l.LastError != "" {
+		desc = append(desc, "error="+l.LastError)
+	}
+	return strings.Join(desc, ",")
+}
+
+//将拓扑输出成文本树,每个主库下面列出它的从库
+//
+//	10.0.0.1:3306 [server_id=1,...]
+//	├── 10.0.0.2:3306 [server_id=2,...] (lag=0s)
+//	│   └── 10.0.0.4:3306 [server_id=4,...] (lag=1s)
+//	└── 10.0.0.3:3306 [server_id=3,...] (lag=0s)
+func (t *Topology) Text() string {
+	var (
+		b       strings.Builder
+		printed = make(map[string]bool, 0)
+	)
+	var walk func(addr, prefix string, path map[string]bool)
+	walk = func(addr, prefix string, path map[string]bool) {
+		links := t.ReplicaLinks(addr)
+		for i, l := range links {
+			branch, next := "├── ", "│   "
+			if i == len(links)-1 {
+				branch, next = "└── ", "    "
+			}
+			n := t.Node(l.Replica)
+			if n == nil {
+				continue
+			}
+			if path[n.Address] {
+				fmt.Fprintf(&b, "%s%s%s (%s,循环复制)\n", prefix, branch, n.Address, l.describe())
+				continue
+			}
+			printed[n.Address] = true
+			fmt.Fprintf(&b, "%s%s%s (%s)\n", prefix, branch, n.describe(), l.describe())
+			path[n.Address] = true
+			walk(n.Address, prefix+next, path)
+			delete(path, n.Address)
+		}
+	}
+	roots := t.roots()
+	for {
+		for _, root := range roots {
+			printed[root.Address] = true
+			b.WriteString(root.describe() + "\n")
+			walk(root.Address, "", map[string]bool{root.Address: true})
+		}
+		//没有从根节点访问到的实例属于其他的循环复制
+		roots = roots[:0]
+		for _, n := range t.Nodes {
+			if !printed[n.Address] {
+				roots = append(roots, n)
+				break
+			}
+		}
+		if len(roots) == 0 {
+			break
+		}
+	}
+	return b.String()
+}
+
+//将拓扑输出成Graphviz DOT格式,无法连接的实例以及复制异常的关系标记为红色
+func (t *Topology) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph topology {\n")
+	b.WriteString("\tnode [shape=box];\n")
+	for _, n := range t.Nodes {
+		label := n.Address
+		attrs := ""
+		if n.Error != "" {
+			label += "\\n" + n.Error
+			attrs = ",color=red,style=dashed"
+		} else {
+			label += fmt.Sprintf("\\nserver_id=%d\\n%s", n.ServerId, n.Version)
+			if n.ReadOnly {
+				label += "\\nread_only"
+			}
+		}
+		fmt.Fprintf(&b, "\t%s [label=%s%s];\n", dotQuote(n.Address), dotQuote(label), attrs)
+	}
+	links := append([]*TopologyLink{}, t.Links...)
+	sort.SliceStable(links, func(i, j int) bool {
+		return links[i].Source < links[j].Source
+	})
+	for _, l := range links {
+		attrs := ""
+		if l.IORunning != "Yes" || l.SQLRunning != "Yes" || l.LastError != "" {
+			attrs = ",color=red"
+		}
+		fmt.Fprintf(&b, "\t%s -> %s [label=%s%s];\n", dotQuote(l.Source), dotQuote(l.Replica), dotQuote(l.describe()), attrs)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+//DOT中的字符串需要使用双引号,并转义其中的双引号
+func dotQuote(s string) string {
+	return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+}
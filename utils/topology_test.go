@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReplicaCandidates(t *testing.T) {
+	replicaHosts := []map[string]string{
+		{"Server_id": "2", "Host": "db2", "Port": "3306"},
+		{"Server_Id": "3", "Host": "", "Port": "3307"},
+	}
+	dumpSessions := []*Session{
+		{Id: 10, Host: "10.0.0.3:51234", Command: "Binlog Dump GTID"},
+		{Id: 11, Host: "10.0.0.2:41234", Command: "Binlog Dump"},
+	}
+	got := replicaCandidates(replicaHosts, dumpSessions)
+	want := []*replicaCandidate{
+		{serverId: 2, addrs: []string{"db2:3306", "10.0.0.3:3306", "10.0.0.2:3306"}},
+		{serverId: 3, addrs: []string{"10.0.0.3:3307", "10.0.0.2:3307"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		for _, c := range got {
+			t.Logf("%+v", c)
+		}
+		t.Errorf("unexpected candidates")
+	}
+	if got := replicaCandidates(replicaHosts[1:], nil); len(got) != 0 {
+		t.Errorf("replica without host and dump thread should be skipped:%v", got)
+	}
+}
+
+func testTopology() *Topology {
+	return &Topology{
+		Nodes: []*TopologyNode{
+			{Address: "db1:3306", ServerId: 1, ServerUUID: "u1", Version: "8.0.30"},
+			{Address: "db2:3306", ServerId: 2, ServerUUID: "u2", Version: "8.0.30", ReadOnly: true},
+			{Address: "db3:3306", ServerId: 3, ServerUUID: "u3", Version: "8.0.30", ReadOnly: true, Lag: -1},
+			{Address: "db4:3306", Lag: -1, Error: "connection refused"},
+		},
+		Links: []*TopologyLink{
+			{Source: "db1:3306", Replica: "db2:3306", IORunning: "Yes", SQLRunning: "Yes"},
+			{Source: "db2:3306", Replica: "db3:3306", IORunning: "Yes", SQLRunning: "No", Lag: -1, LastError: "Error 1062"},
+			{Source: "db1:3306", Replica: "db4:3306", Channel: "ch1", IORunning: "Yes", SQLRunning: "Yes", Lag: 5},
+		},
+	}
+}
+
+func TestTopology_Text(t *testing.T) {
+	want := strings.Join([]string{
+		"db1:3306 [server_id=1,uuid=u1,version=8.0.30]",
+		"├── db2:3306 [server_id=2,uuid=u2,version=8.0.30,read_only] (lag=0s)",
+		"│   └── db3:3306 [server_id=3,uuid=u3,version=8.0.30,read_only] (lag=NULL,io=Yes,sql=No,error=Error 1062)",
+		"└── db4:3306 [无法连接:connection refused] (channel=ch1,lag=5s)",
+		"",
+	}, "\n")
+	if got := testTopology().Text(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	//双主循环复制
+	topo := &Topology{
+		Nodes: []*TopologyNode{{Address: "a:3306"}, {Address: "b:3306"}},
+		Links: []*TopologyLink{
+			{Source: "a:3306", Replica: "b:3306", IORunning: "Yes", SQLRunning: "Yes"},
+			{Source: "b:3306", Replica: "a:3306", IORunning: "Yes", SQLRunning: "Yes"},
+		},
+	}
+	if got := topo.Text(); !strings.Contains(got, "└── a:3306 (lag=0s,循环复制)") {
+		t.Errorf("cycle not detected:\n%s", got)
+	}
+}
+
+func TestTopology_DOT(t *testing.T) {
+	got := testTopology().DOT()
+	for _, want := range []string{
+		`"db1:3306" [label="db1:3306\nserver_id=1\n8.0.30"];`,
+		`"db4:3306" [label="db4:3306\nconnection refused",color=red,style=dashed];`,
+		`"db2:3306" -> "db3:3306" [label="lag=NULL,io=Yes,sql=No,error=Error 1062",color=red];`,
+		`"db1:3306" -> "db4:3306" [label="channel=ch1,lag=5s"];`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %s in:\n%s", want, got)
+		}
+	}
+}
+
+func TestTopology_JSON(t *testing.T) {
+	data, err := testTopology().JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	topo := new(Topology)
+	if err := json.Unmarshal(data, topo); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(topo, testTopology()) {
+		t.Errorf("json round trip mismatch:%s", data)
+	}
+}
@@ -0,0 +1,542 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+//用户账号的属性描述,用于CreateUser
+type UserSpec struct {
+	User     string
+	Host     string //为空时等同于%
+	Password string //明文密码
+	//认证插件:mysql_native_password,caching_sha2_password,sha256_password,auth_socket等
+	//为空时使用服务端默认插件
+	Plugin string
+	//密码有效天数,0表示使用全局参数default_password_lifetime,-1表示永不过期
+	PasswordLifetime int
+	ExpireNow        bool //密码立即过期,用户下次登录后必须修改密码
+	AccountLocked    bool //锁定账号
+
+	MaxQueriesPerHour     int //每小时最大查询数,0表示不限制
+	MaxUpdatesPerHour     int //每小时最大更新数,0表示不限制
+	MaxConnectionsPerHour int //每小时最大连接数,0表示不限制
+	MaxUserConnections    int //最大并发连接数,0表示不限制
+
+	RequireSSL  bool //要求使用SSL连接
+	RequireX509 bool //要求客户端提供有效的X509证书
+	Comment     string
+}
+
+//用户管理相关的SQL都需要至少5.7.6版本才支持
+var minUserMgmtVersion = [3]int{5, 7, 6}
+
+//SSL要求,用于UserChange.Require
+const (
+	UserRequireNone = "NONE"
+	UserRequireSSL  = "SSL"
+	UserRequireX509 = "X509"
+)
+
+//用户账号的修改内容,用于AlterUser
+//只有设置了的字段才会生成对应的子句,字符串为空、指针为nil表示保持不变
+type UserChange struct {
+	User       string
+	Host       string //为空时等同于%
+	Password   string //新的明文密码
+	Plugin     string //新的认证插件,必须同时指定Password或AuthString
+	AuthString string //认证插件对应的密码哈希,即IDENTIFIED WITH plugin AS,与Password二选一
+
+	PasswordLifetime *int  //密码有效天数,0表示使用全局参数default_password_lifetime,-1表示永不过期
+	ExpireNow        bool  //密码立即过期,用户下次登录后必须修改密码
+	AccountLocked    *bool //锁定或者解锁账号
+
+	MaxQueriesPerHour     *int //0表示不限制
+	MaxUpdatesPerHour     *int
+	MaxConnectionsPerHour *int
+	MaxUserConnections    *int
+
+	Require string  //UserRequireNone、UserRequireSSL或UserRequireX509
+	Comment *string //用户注释,8.0.21及以上版本
+}
+
+//校验认证插件名以及插件对版本的要求
+func checkPlugin(plugin string, version [3]int) error {
+	if err := checkKeyword("认证插件", plugin); err != nil {
+		return err
+	}
+	if plugin == "caching_sha2_password" && version[0] < 8 {
+		return errors.New(fmt.Sprintf("caching_sha2_password需要MySQL 8.0及以上版本,当前版本:%v", version))
+	}
+	return nil
+}
+
+//检查版本是否支持用户管理语句
+func checkUserMgmtVersion(verb string, version [3]int) error {
+	if !versionAtLeast(version, minUserMgmtVersion) {
+		return errors.New(fmt.Sprintf("%s需要MySQL %d.%d.%d及以上版本,当前版本:%v", verb,
+			minUserMgmtVersion[0], minUserMgmtVersion[1], minUserMgmtVersion[2], version))
+	}
+	return nil
+}
+
+//用户注释从8.0.21开始支持
+func commentClause(comment string, version [3]int) (string, error) {
+	if !versionAtLeast(version, [3]int{8, 0, 21}) {
+		return "", errors.New(fmt.Sprintf("用户注释需要MySQL 8.0.21及以上版本,当前版本:%v", version))
+	}
+	return " COMMENT " + quoteLiteral(comment), nil
+}
+
+//根据UserSpec生成CREATE USER语句,version为数据库版本
+func buildCreateUserSQL(spec *UserSpec, version [3]int) (string, error) {
+	if spec.User == "" {
+		return "", errors.New("用户名不能为空")
+	}
+	if err := checkUserMgmtVersion("CREATE USER", version); err != nil {
+		return "", err
+	}
+	host := spec.Host
+	if host == "" {
+		host = "%"
+	}
+	var b strings.Builder
+	b.WriteString("CREATE USER " + userName(spec.User, host))
+	//认证方式
+	switch {
+	case spec.Plugin != "":
+		if err := checkPlugin(spec.Plugin, version); err != nil {
+			return "", err
+		}
+		b.WriteString(" IDENTIFIED WITH " + spec.Plugin)
+		if spec.Password != "" {
+			b.WriteString(" BY " + quoteLiteral(spec.Password))
+		}
+	case spec.Password != "":
+		b.WriteString(" IDENTIFIED BY " + quoteLiteral(spec.Password))
+	}
+	//SSL要求
+	switch {
+	case spec.RequireX509:
+		b.WriteString(" REQUIRE X509")
+	case spec.RequireSSL:
+		b.WriteString(" REQUIRE SSL")
+	default:
+		b.WriteString(" REQUIRE NONE")
+	}
+	//资源限制
+	b.WriteString(fmt.Sprintf(" WITH MAX_QUERIES_PER_HOUR %d MAX_UPDATES_PER_HOUR %d MAX_CONNECTIONS_PER_HOUR %d MAX_USER_CONNECTIONS %d",
+		spec.MaxQueriesPerHour, spec.MaxUpdatesPerHour, spec.MaxConnectionsPerHour, spec.MaxUserConnections))
+	//密码过期策略
+	switch {
+	case spec.ExpireNow:
+		b.WriteString(" PASSWORD EXPIRE")
+	case spec.PasswordLifetime > 0:
+		b.WriteString(fmt.Sprintf(" PASSWORD EXPIRE INTERVAL %d DAY", spec.PasswordLifetime))
+	case spec.PasswordLifetime < 0:
+		b.WriteString(" PASSWORD EXPIRE NEVER")
+	default:
+		b.WriteString(" PASSWORD EXPIRE DEFAULT")
+	}
+	//账号锁定
+	if spec.AccountLocked {
+		b.WriteString(" ACCOUNT LOCK")
+	} else {
+		b.WriteString(" ACCOUNT UNLOCK")
+	}
+	if spec.Comment != "" {
+		comment, err := commentClause(spec.Comment, version)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(comment)
+	}
+	return b.String(), nil
+}
+
+//根据UserChange生成ALTER USER语句,只包含需要修改的子句
+//plugin为用户当前的认证插件,只修改密码时用于保持插件不变
+func buildAlterUserSQL(change *UserChange, plugin string, version [3]int) (string, error) {
+	if change.User == "" {
+		return "", errors.New("用户名不能为空")
+	}
+	if err := checkUserMgmtVersion("ALTER USER", version); err != nil {
+		return "", err
+	}
+	host := change.Host
+	if host == "" {
+		host = "%"
+	}
+	var clauses []string
+	//认证方式
+	if change.Password != "" && change.AuthString != "" {
+		return "", errors.New("Password和AuthString不能同时指定")
+	}
+	if change.Plugin != "" {
+		plugin = change.Plugin
+		if change.Password == "" && change.AuthString == "" {
+			return "", errors.New(fmt.Sprintf("修改认证插件为%s时必须同时指定密码,否则密码会被置空", plugin))
+		}
+	}
+	switch {
+	case change.Password != "" || change.AuthString != "":
+		if plugin == "" {
+			return "", errors.New("修改密码时需要知道认证插件")
+		}
+		if err := checkPlugin(plugin, version); err != nil {
+			return "", err
+		}
+		if change.Password != "" {
+			clauses = append(clauses, "IDENTIFIED WITH "+plugin+" BY "+quoteLiteral(change.Password))
+		} else {
+			clauses = append(clauses, "IDENTIFIED WITH "+plugin+" AS "+quoteLiteral(change.AuthString))
+		}
+	}
+	switch change.Require {
+	case "":
+	case UserRequireNone, UserRequireSSL, UserRequireX509:
+		clauses = append(clauses, "REQUIRE "+change.Require)
+	default:
+		return "", errors.New("非法的SSL要求:" + change.Require)
+	}
+	//资源限制
+	var limits []string
+	for _, limit := range []struct {
+		name  string
+		value *int
+	}{
+		{"MAX_QUERIES_PER_HOUR", change.MaxQueriesPerHour},
+		{"MAX_UPDATES_PER_HOUR", change.MaxUpdatesPerHour},
+		{"MAX_CONNECTIONS_PER_HOUR", change.MaxConnectionsPerHour},
+		{"MAX_USER_CONNECTIONS", change.MaxUserConnections},
+	} {
+		if limit.value != nil {
+			limits = append(limits, fmt.Sprintf("%s %d", limit.name, *limit.value))
+		}
+	}
+	if len(limits) > 0 {
+		clauses = append(clauses, "WITH "+strings.Join(limits, " "))
+	}
+	//密码过期策略
+	if change.ExpireNow {
+		clauses = append(clauses, "PASSWORD EXPIRE")
+	}
+	if change.PasswordLifetime != nil {
+		switch lifetime := *change.PasswordLifetime; {
+		case lifetime > 0:
+			clauses = append(clauses, fmt.Sprintf("PASSWORD EXPIRE INTERVAL %d DAY", lifetime))
+		case lifetime < 0:
+			clauses = append(clauses, "PASSWORD EXPIRE NEVER")
+		default:
+			clauses = append(clauses, "PASSWORD EXPIRE DEFAULT")
+		}
+	}
+	if change.AccountLocked != nil {
+		if *change.AccountLocked {
+			clauses = append(clauses, "ACCOUNT LOCK")
+		} else {
+			clauses = append(clauses, "ACCOUNT UNLOCK")
+		}
+	}
+	if change.Comment != nil {
+		comment, err := commentClause(*change.Comment, version)
+		if err != nil {
+			return "", err
+		}
+		clauses = append(clauses, strings.TrimSpace(comment))
+	}
+	if len(clauses) == 0 {
+		return "", errors.New(fmt.Sprintf("用户%s没有需要修改的属性", userName(change.User, host)))
+	}
+	return "ALTER USER " + userName(change.User, host) + " " + strings.Join(clauses, " "), nil
+}
+
+//创建一个用户
+func (d *DBHandler) CreateUser(spec *UserSpec) error {
+	return d.CreateUserContext(context.Background(), spec)
+}
+
+//同CreateUser,ctx用于超时和取消控制
+func (d *DBHandler) CreateUserContext(ctx context.Context, spec *UserSpec) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	version, err := d.GetVersionContext(ctx)
+	if err != nil {
+		return err
+	}
+	createUserSQL, err := buildCreateUserSQL(spec, version)
+	if err != nil {
+		return err
+	}
+	_, err = d.conn.ExecContext(ctx, createUserSQL)
+	return err
+}
+
+//修改一个用户,包括密码、认证插件、过期策略、锁定状态、资源限制等
+//只修改change中设置了的属性,其余属性保持不变;只修改密码时保持用户当前的认证插件
+func (d *DBHandler) AlterUser(change *UserChange) error {
+	return d.AlterUserContext(context.Background(), change)
+}
+
+//同AlterUser,ctx用于超时和取消控制
+func (d *DBHandler) AlterUserContext(ctx context.Context, change *UserChange) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	version, err := d.GetVersionContext(ctx)
+	if err != nil {
+		return err
+	}
+	host := change.Host
+	if host == "" {
+		host = "%"
+	}
+	//只修改密码时,需要显式指定当前的插件,避免插件被改成服务端默认插件
+	var plugin string
+	if change.Plugin == "" && (change.Password != "" || change.AuthString != "") {
+		row := d.conn.QueryRowContext(ctx, "SELECT plugin FROM mysql.user WHERE host=? AND user=?", host, change.User)
+		if err := row.Scan(&plugin); err != nil {
+			if err == sql.ErrNoRows {
+				return errors.New(fmt.Sprintf("用户%s不存在", userName(change.User, host)))
+			}
+			return err
+		}
+	}
+	alterUserSQL, err := buildAlterUserSQL(change, plugin, version)
+	if err != nil {
+		return err
+	}
+	_, err = d.conn.ExecContext(ctx, alterUserSQL)
+	return err
+}
+
+//锁定一个用户,已经建立的连接不受影响
+func (d *DBHandler) LockUser(user, host string) error {
+	return d.LockUserContext(context.Background(), user, host)
+}
+
+//同LockUser,ctx用于超时和取消控制
+func (d *DBHandler) LockUserContext(ctx context.Context, user, host string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	return d.alterUserOption(ctx, user, host, "ACCOUNT LOCK")
+}
+
+//解锁一个用户
+func (d *DBHandler) UnlockUser(user, host string) error {
+	return d.UnlockUserContext(context.Background(), user, host)
+}
+
+//同UnlockUser,ctx用于超时和取消控制
+func (d *DBHandler) UnlockUserContext(ctx context.Context, user, host string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	return d.alterUserOption(ctx, user, host, "ACCOUNT UNLOCK")
+}
+
+//使一个用户的密码立即过期,用户下次登录后必须修改密码
+func (d *DBHandler) ExpirePassword(user, host string) error {
+	return d.ExpirePasswordContext(context.Background(), user, host)
+}
+
+//同ExpirePassword,ctx用于超时和取消控制
+func (d *DBHandler) ExpirePasswordContext(ctx context.Context, user, host string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	return d.alterUserOption(ctx, user, host, "PASSWORD EXPIRE")
+}
+
+//对用户执行单个ALTER USER选项
+func (d *DBHandler) alterUserOption(ctx context.Context, user, host, option string) error {
+	version, err := d.GetVersionContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !versionAtLeast(version, minUserMgmtVersion) {
+		return errors.New(fmt.Sprintf("ALTER USER %s需要MySQL %d.%d.%d及以上版本,当前版本:%v", option,
+			minUserMgmtVersion[0], minUserMgmtVersion[1], minUserMgmtVersion[2], version))
+	}
+	_, err = d.conn.ExecContext(ctx, fmt.Sprintf("ALTER USER %s %s", userName(user, host), option))
+	return err
+}
+
+//账号信息,UserSpec中的Password始终为空,认证信息保存在AuthString中
+type UserInfo struct {
+	UserSpec
+	AuthString          string    //认证插件对应的密码哈希
+	PasswordExpired     bool      //密码是否已经过期
+	PasswordLastChanged time.Time //密码最后修改时间
+}
+
+//查看数据库中的所有账号
+func (d *DBHandler) ListUsers() ([]*UserInfo, error) {
+	return d.ListUsersContext(context.Background())
+}
+
+//同ListUsers,ctx用于超时和取消控制
+func (d *DBHandler) ListUsersContext(ctx context.Context) ([]*UserInfo, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	version, err := d.GetVersionContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !versionAtLeast(version, minUserMgmtVersion) {
+		return nil, errors.New(fmt.Sprintf("ListUsers需要MySQL %d.%d.%d及以上版本,当前版本:%v",
+			minUserMgmtVersion[0], minUserMgmtVersion[1], minUserMgmtVersion[2], version))
+	}
+	listUsersSQL := "SELECT user,host,plugin,authentication_string,password_expired,password_lifetime,password_last_changed," +
+		"account_locked,max_questions,max_updates,max_connections,max_user_connections,ssl_type FROM mysql.user ORDER BY user,host"
+	rows, err := d.conn.QueryContext(ctx, listUsersSQL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var (
+		users               = make([]*UserInfo, 0)
+		authString          sql.NullString
+		passwordExpired     string
+		passwordLifetime    sql.NullInt64
+		passwordLastChanged sql.NullTime
+		accountLocked       string
+		sslType             string
+	)
+	for rows.Next() {
+		u := new(UserInfo)
+		if err := rows.Scan(&u.User, &u.Host, &u.Plugin, &authString, &passwordExpired, &passwordLifetime, &passwordLastChanged,
+			&accountLocked, &u.MaxQueriesPerHour, &u.MaxUpdatesPerHour, &u.MaxConnectionsPerHour, &u.MaxUserConnections, &sslType); err != nil {
+			return nil, err
+		}
+		u.AuthString = authString.String
+		u.PasswordExpired = passwordExpired == "Y"
+		u.ExpireNow = u.PasswordExpired
+		//password_lifetime为NULL表示使用全局参数,为0表示永不过期
+		switch {
+		case !passwordLifetime.Valid:
+			u.PasswordLifetime = 0
+		case passwordLifetime.Int64 == 0:
+			u.PasswordLifetime = -1
+		default:
+			u.PasswordLifetime = int(passwordLifetime.Int64)
+		}
+		u.PasswordLastChanged = passwordLastChanged.Time
+		u.AccountLocked = accountLocked == "Y"
+		switch sslType {
+		case "ANY":
+			u.RequireSSL = true
+		case "X509":
+			u.RequireX509 = true
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	//用户注释从8.0.21开始支持,保存在information_schema.user_attributes中
+	if versionAtLeast(version, [3]int{8, 0, 21}) {
+		if err := d.fillUserComments(ctx, users); err != nil {
+			return nil, err
+		}
+	}
+	return users, nil
+}
+
+//从information_schema.user_attributes中读取用户注释
+func (d *DBHandler) fillUserComments(ctx context.Context, users []*UserInfo) error {
+	rows, err := d.conn.QueryContext(ctx, "SELECT user,host,attribute FROM information_schema.user_attributes WHERE attribute IS NOT NULL")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	comments := make(map[Account]string, 0)
+	for rows.Next() {
+		var (
+			account   Account
+			attribute string
+			attrs     struct {
+				Comment string `json:"comment"`
+			}
+		)
+		if err := rows.Scan(&account.User, &account.Host, &attribute); err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(attribute), &attrs); err != nil {
+			continue
+		}
+		comments[account] = attrs.Comment
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, u := range users {
+		u.Comment = comments[Account{User: u.User, Host: u.Host}]
+	}
+	return nil
+}
+
+//获取SHOW CREATE USER的结果
+//8.0.17开始caching_sha2_password等插件的密码哈希可能包含不可打印字符,需要开启print_identified_with_as_hex以十六进制输出
+func (d *DBHandler) showCreateUser(ctx context.Context, user, host string, version [3]int) (string, error) {
+	conn, err := d.conn.Conn(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if versionAtLeast(version, [3]int{8, 0, 17}) {
+		if _, err := conn.ExecContext(ctx, "SET SESSION print_identified_with_as_hex = ON"); err != nil {
+			return "", err
+		}
+	}
+	var showCreateUserResult string
+	row := conn.QueryRowContext(ctx, fmt.Sprintf("SHOW CREATE USER %s", userName(user, host)))
+	if err := row.Scan(&showCreateUserResult); err != nil {
+		return "", err
+	}
+	return showCreateUserResult, nil
+}
+
+//查看用户的默认角色,仅8.0及以上版本支持
+func (d *DBHandler) defaultRoles(ctx context.Context, user, host string) ([]Account, error) {
+	rows, err := d.conn.QueryContext(ctx, "SELECT DEFAULT_ROLE_USER,DEFAULT_ROLE_HOST FROM mysql.default_roles WHERE USER=? AND HOST=?", user, host)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	roles := make([]Account, 0)
+	for rows.Next() {
+		var role Account
+		if err := rows.Scan(&role.User, &role.Host); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+//将SHOW CREATE USER的结果改写为创建另一个用户的语句
+//5.7:CREATE USER 'test1'@'%' IDENTIFIED WITH 'mysql_native_password' AS '*94BD...' REQUIRE NONE ...
+//8.0:CREATE USER `test1`@`%` IDENTIFIED WITH 'caching_sha2_password' AS 0x2441... DEFAULT ROLE `r1`@`%` REQUIRE NONE ...
+//其中的DEFAULT ROLE子句会被去掉,因为角色需要先授权给用户才能设置为默认角色
+func rewriteCreateUser(stmt string, to Account) (string, error) {
+	const prefix = "CREATE USER "
+	stmt = strings.TrimSpace(stmt)
+	if !strings.HasPrefix(strings.ToUpper(stmt), prefix) {
+		return "", errors.New("无法匹配用户" + stmt)
+	}
+	_, rest, err := splitAccountPrefix(stmt[len(prefix):])
+	if err != nil {
+		return "", errors.Wrap(err, "无法匹配用户"+stmt)
+	}
+	if start := indexKeyword(rest, "DEFAULT ROLE"); start >= 0 {
+		end := indexKeyword(rest[start:], "REQUIRE")
+		if end < 0 {
+			return "", errors.New("无法去掉默认角色" + stmt)
+		}
+		rest = rest[:start] + rest[start+end:]
+	}
+	return prefix + to.String() + rest, nil
+}
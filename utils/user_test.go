@@ -0,0 +1,233 @@
+package utils
+
+import "testing"
+
+func TestBuildCreateUserSQL(t *testing.T) {
+	const defaults = " REQUIRE NONE WITH MAX_QUERIES_PER_HOUR 0 MAX_UPDATES_PER_HOUR 0 MAX_CONNECTIONS_PER_HOUR 0 MAX_USER_CONNECTIONS 0 PASSWORD EXPIRE DEFAULT ACCOUNT UNLOCK"
+	v57 := [3]int{5, 7, 30}
+	v80 := [3]int{8, 0, 32}
+	cases := []struct {
+		name    string
+		spec    UserSpec
+		version [3]int
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "default plugin",
+			spec:    UserSpec{User: "app", Host: "%", Password: "p'w"},
+			version: v57,
+			want:    `CREATE USER 'app'@'%' IDENTIFIED BY 'p''w'` + defaults,
+		},
+		{
+			name:    "caching sha2",
+			spec:    UserSpec{User: "app", Password: "pw", Plugin: "caching_sha2_password"},
+			version: v80,
+			want:    `CREATE USER 'app'@'%' IDENTIFIED WITH caching_sha2_password BY 'pw'` + defaults,
+		},
+		{
+			name:    "caching sha2 on 5.7",
+			spec:    UserSpec{User: "app", Password: "pw", Plugin: "caching_sha2_password"},
+			version: v57,
+			wantErr: true,
+		},
+		{
+			name:    "auth socket",
+			spec:    UserSpec{User: "root", Host: "localhost", Plugin: "auth_socket"},
+			version: v80,
+			want:    `CREATE USER 'root'@'localhost' IDENTIFIED WITH auth_socket` + defaults,
+		},
+		{
+			name: "all options",
+			spec: UserSpec{User: "app", Host: "10.%", Password: "pw", PasswordLifetime: 90, AccountLocked: true,
+				MaxQueriesPerHour: 1000, MaxUpdatesPerHour: 100, MaxConnectionsPerHour: 10, MaxUserConnections: 5,
+				RequireSSL: true, Comment: "app account"},
+			version: v80,
+			want: `CREATE USER 'app'@'10.%' IDENTIFIED BY 'pw' REQUIRE SSL WITH MAX_QUERIES_PER_HOUR 1000 MAX_UPDATES_PER_HOUR 100` +
+				` MAX_CONNECTIONS_PER_HOUR 10 MAX_USER_CONNECTIONS 5 PASSWORD EXPIRE INTERVAL 90 DAY ACCOUNT LOCK COMMENT 'app account'`,
+		},
+		{
+			name:    "comment before 8.0.21",
+			spec:    UserSpec{User: "app", Comment: "x"},
+			version: [3]int{8, 0, 20},
+			wantErr: true,
+		},
+		{
+			name:    "too old",
+			spec:    UserSpec{User: "app"},
+			version: [3]int{5, 6, 40},
+			wantErr: true,
+		},
+		{
+			name:    "invalid plugin",
+			spec:    UserSpec{User: "app", Plugin: "x BY 'a'"},
+			version: v80,
+			wantErr: true,
+		},
+		{
+			name:    "empty user",
+			spec:    UserSpec{},
+			version: v80,
+			wantErr: true,
+		},
+	}
+	for _, c := range cases {
+		got, err := buildCreateUserSQL(&c.spec, c.version)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s: err=%v,wantErr %v", c.name, err, c.wantErr)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s:\n got:%s\nwant:%s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestBuildAlterUserSQL(t *testing.T) {
+	v57 := [3]int{5, 7, 30}
+	v80 := [3]int{8, 0, 32}
+	never, thirty := -1, 30
+	locked, unlocked := true, false
+	zero := 0
+	comment := "x"
+	cases := []struct {
+		name    string
+		change  UserChange
+		plugin  string
+		version [3]int
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "password only keeps other attributes",
+			change:  UserChange{User: "app", Password: "p'w"},
+			plugin:  "mysql_native_password",
+			version: v57,
+			want:    `ALTER USER 'app'@'%' IDENTIFIED WITH mysql_native_password BY 'p''w'`,
+		},
+		{
+			name:    "change plugin",
+			change:  UserChange{User: "app", Host: "10.%", Password: "pw", Plugin: "caching_sha2_password"},
+			plugin:  "mysql_native_password",
+			version: v80,
+			want:    `ALTER USER 'app'@'10.%' IDENTIFIED WITH caching_sha2_password BY 'pw'`,
+		},
+		{
+			name:    "change plugin with auth string",
+			change:  UserChange{User: "app", Plugin: "mysql_native_password", AuthString: "*94BDCEBE19083CE2A1F959FD02F964C7AF4CFC29"},
+			version: v57,
+			want:    `ALTER USER 'app'@'%' IDENTIFIED WITH mysql_native_password AS '*94BDCEBE19083CE2A1F959FD02F964C7AF4CFC29'`,
+		},
+		{
+			name:    "change plugin without password",
+			change:  UserChange{User: "app", Plugin: "caching_sha2_password"},
+			version: v80,
+			wantErr: true,
+		},
+		{
+			name:    "password and auth string",
+			change:  UserChange{User: "app", Password: "pw", AuthString: "*94BD"},
+			plugin:  "mysql_native_password",
+			version: v80,
+			wantErr: true,
+		},
+		{
+			name:    "lock only",
+			change:  UserChange{User: "app", AccountLocked: &locked},
+			version: v57,
+			want:    `ALTER USER 'app'@'%' ACCOUNT LOCK`,
+		},
+		{
+			name: "several attributes",
+			change: UserChange{User: "app", Require: UserRequireX509, PasswordLifetime: &never, MaxUserConnections: &zero,
+				AccountLocked: &unlocked, Comment: &comment},
+			version: v80,
+			want:    `ALTER USER 'app'@'%' REQUIRE X509 WITH MAX_USER_CONNECTIONS 0 PASSWORD EXPIRE NEVER ACCOUNT UNLOCK COMMENT 'x'`,
+		},
+		{
+			name:    "expire now",
+			change:  UserChange{User: "app", ExpireNow: true, PasswordLifetime: &thirty},
+			version: v80,
+			want:    `ALTER USER 'app'@'%' PASSWORD EXPIRE PASSWORD EXPIRE INTERVAL 30 DAY`,
+		},
+		{
+			name:    "invalid require",
+			change:  UserChange{User: "app", Require: "ISSUER"},
+			version: v80,
+			wantErr: true,
+		},
+		{
+			name:    "comment before 8.0.21",
+			change:  UserChange{User: "app", Comment: &comment},
+			version: [3]int{8, 0, 20},
+			wantErr: true,
+		},
+		{
+			name:    "nothing to change",
+			change:  UserChange{User: "app"},
+			version: v80,
+			wantErr: true,
+		},
+	}
+	for _, c := range cases {
+		got, err := buildAlterUserSQL(&c.change, c.plugin, c.version)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s: err=%v,wantErr %v", c.name, err, c.wantErr)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s:\n got:%s\nwant:%s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	cases := []struct {
+		version, min [3]int
+		want         bool
+	}{
+		{[3]int{8, 0, 22}, [3]int{8, 0, 22}, true},
+		{[3]int{8, 0, 21}, [3]int{8, 0, 22}, false},
+		{[3]int{5, 7, 40}, [3]int{8, 0, 0}, false},
+		{[3]int{8, 1, 0}, [3]int{8, 0, 30}, true},
+	}
+	for _, c := range cases {
+		if got := versionAtLeast(c.version, c.min); got != c.want {
+			t.Errorf("versionAtLeast(%v,%v)=%v,want %v", c.version, c.min, got, c.want)
+		}
+	}
+}
+
+func TestRewriteCreateUser(t *testing.T) {
+	to := Account{User: "app2", Host: "10.%"}
+	cases := []struct {
+		stmt    string
+		want    string
+		wantErr bool
+	}{
+		{
+			stmt: "CREATE USER 'test1'@'%' IDENTIFIED WITH 'mysql_native_password' AS '*94BDCEBE19083CE2A1F959FD02F964C7AF4CFC29' REQUIRE NONE PASSWORD EXPIRE DEFAULT ACCOUNT UNLOCK",
+			want: "CREATE USER 'app2'@'10.%' IDENTIFIED WITH 'mysql_native_password' AS '*94BDCEBE19083CE2A1F959FD02F964C7AF4CFC29' REQUIRE NONE PASSWORD EXPIRE DEFAULT ACCOUNT UNLOCK",
+		},
+		{
+			stmt: "CREATE USER `test1`@`%` IDENTIFIED WITH 'caching_sha2_password' AS 0x24412430 DEFAULT ROLE `r1`@`%`,`r2`@`%` REQUIRE NONE PASSWORD EXPIRE DEFAULT ACCOUNT UNLOCK PASSWORD HISTORY DEFAULT",
+			want: "CREATE USER 'app2'@'10.%' IDENTIFIED WITH 'caching_sha2_password' AS 0x24412430 REQUIRE NONE PASSWORD EXPIRE DEFAULT ACCOUNT UNLOCK PASSWORD HISTORY DEFAULT",
+		},
+		{
+			stmt: "CREATE USER `o``k`@`%` IDENTIFIED WITH 'auth_socket' REQUIRE NONE",
+			want: "CREATE USER 'app2'@'10.%' IDENTIFIED WITH 'auth_socket' REQUIRE NONE",
+		},
+		{stmt: "DROP USER `test1`@`%`", wantErr: true},
+		{stmt: "CREATE USER `test1 IDENTIFIED", wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := rewriteCreateUser(c.stmt, to)
+		if (err != nil) != c.wantErr {
+			t.Errorf("rewriteCreateUser(%q) err=%v,wantErr %v", c.stmt, err, c.wantErr)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("rewriteCreateUser(%q)\n got:%s\nwant:%s", c.stmt, got, c.want)
+		}
+	}
+}
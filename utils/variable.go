@@ -0,0 +1,580 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//8.0开始支持SET PERSIST和performance_schema.variables_info
+var persistVariableVersion = [3]int{8, 0, 0}
+
+//参数的修改方式
+const (
+	SetGlobal      = "GLOBAL"       //SET GLOBAL,重启后失效
+	SetPersist     = "PERSIST"      //SET PERSIST,立即生效并写入mysqld-auto.cnf,8.0及以上版本
+	SetPersistOnly = "PERSIST_ONLY" //SET PERSIST_ONLY,只写入mysqld-auto.cnf,重启后生效,可以修改静态参数
+	SetMycnfOnly   = "MYCNF_ONLY"   //只写入my.cnf,不修改运行中的实例,需要指定Mycnf
+)
+
+//参数值的类型
+const (
+	VariableTypeBool   = "bool"
+	VariableTypeInt    = "int"
+	VariableTypeFloat  = "float"
+	VariableTypeEnum   = "enum"
+	VariableTypeString = "string"
+)
+
+//不能动态修改的参数,只能通过PERSIST_ONLY或者my.cnf修改后重启生效
+//performance_schema.variables_info中没有是否为动态参数的信息,所有版本都使用该目录
+//只在部分版本中为静态的参数(如5.7的innodb_log_buffer_size)不列出,修改时根据服务端的报错提示
+var staticVariables = map[string]bool{
+	"back_log":                               true,
+	"basedir":                                true,
+	"bind_address":                           true,
+	"character_set_system":                   true,
+	"datadir":                                true,
+	"default_authentication_plugin":          true,
+	"ft_max_word_len":                        true,
+	"ft_min_word_len":                        true,
+	"innodb_buffer_pool_instances":           true,
+	"innodb_data_file_path":                  true,
+	"innodb_data_home_dir":                   true,
+	"innodb_doublewrite":                     true,
+	"innodb_flush_method":                    true,
+	"innodb_force_recovery":                  true,
+	"innodb_log_file_size":                   true,
+	"innodb_log_files_in_group":              true,
+	"innodb_log_group_home_dir":              true,
+	"innodb_open_files":                      true,
+	"innodb_page_size":                       true,
+	"innodb_purge_threads":                   true,
+	"innodb_read_io_threads":                 true,
+	"innodb_rollback_on_timeout":             true,
+	"innodb_temp_data_file_path":             true,
+	"innodb_undo_directory":                  true,
+	"innodb_undo_tablespaces":                true,
+	"innodb_write_io_threads":                true,
+	"log_bin":                                true,
+	"log_bin_basename":                       true,
+	"log_bin_index":                          true,
+	"log_error":                              true,
+	"lower_case_table_names":                 true,
+	"open_files_limit":                       true,
+	"performance_schema":                     true,
+	"pid_file":                               true,
+	"plugin_dir":                             true,
+	"port":                                   true,
+	"relay_log":                              true,
+	"relay_log_index":                        true,
+	"report_host":                            true,
+	"report_port":                            true,
+	"server_uuid":                            true,
+	"skip_external_locking":                  true,
+	"skip_name_resolve":                      true,
+	"skip_networking":                        true,
+	"socket":                                 true,
+	"thread_handling":                        true,
+	"tmpdir":                                 true,
+	"version":                                true,
+	"version_comment":                        true,
+	"hostname":                               true,
+	"have_ssl":                               true,
+	"log_slave_updates":                      true,
+	"log_replica_updates":                    true,
+	"table_open_cache_instances":             true,
+	"performance_schema_max_sql_text_length": true,
+	"innodb_autoinc_lock_mode":               true,
+	"innodb_buffer_pool_chunk_size":          true,
+	"thread_stack":                           true,
+	"large_pages":                            true,
+	"innodb_page_cleaners":                   true,
+	"innodb_sort_buffer_size":                true,
+	"innodb_ft_min_token_size":               true,
+	"innodb_ft_max_token_size":               true,
+	"innodb_numa_interleave":                 true,
+	"innodb_use_native_aio":                  true,
+	"innodb_directories":                     true,
+	"ft_query_expansion_limit":               true,
+	"ft_stopword_file":                       true,
+	"skip_show_database":                     true,
+	"max_digest_length":                      true,
+	"performance_schema_digests_size":        true,
+	"binlog_gtid_simple_recovery":            true,
+	"relay_log_recovery":                     true,
+	"relay_log_info_file":                    true,
+	"disabled_storage_engines":               true,
+	"secure_file_priv":                       true,
+	"character_sets_dir":                     true,
+	"lc_messages_dir":                        true,
+	"named_pipe":                             true,
+	"shared_memory":                          true,
+	"admin_address":                          true,
+	"admin_port":                             true,
+	"mysqlx_port":                            true,
+	"skip_slave_start":                       true,
+	"skip_replica_start":                     true,
+	"slave_load_tmpdir":                      true,
+	"replica_load_tmpdir":                    true,
+	"lower_case_file_system":                 true,
+	"core_file":                              true,
+	"innodb_validate_tablespace_paths":       true,
+	"innodb_dedicated_server":                true,
+	"myisam_recover_options":                 true,
+	"myisam_mmap_size":                       true,
+	"old":                                    true,
+	"large_page_size":                        true,
+}
+
+//布尔类型的参数,当前值为ON/OFF的参数不一定是布尔类型,如query_cache_type还可以为DEMAND,只有列出的参数才按布尔类型校验
+var boolVariables = map[string]bool{
+	"autocommit":              true,
+	"automatic_sp_privileges": true,
+	"big_tables":              true,
+	"binlog_direct_non_transactional_updates": true,
+	"binlog_encryption":                       true,
+	"binlog_order_commits":                    true,
+	"binlog_rows_query_log_events":            true,
+	"check_proxy_users":                       true,
+	"default_table_encryption":                true,
+	"end_markers_in_json":                     true,
+	"explicit_defaults_for_timestamp":         true,
+	"foreign_key_checks":                      true,
+	"general_log":                             true,
+	"innodb_adaptive_flushing":                true,
+	"innodb_adaptive_hash_index":              true,
+	"innodb_buffer_pool_dump_at_shutdown":     true,
+	"innodb_buffer_pool_load_at_startup":      true,
+	"innodb_deadlock_detect":                  true,
+	"innodb_file_per_table":                   true,
+	"innodb_flush_sync":                       true,
+	"innodb_print_all_deadlocks":              true,
+	"innodb_random_read_ahead":                true,
+	"innodb_redo_log_encrypt":                 true,
+	"innodb_stats_on_metadata":                true,
+	"innodb_stats_persistent":                 true,
+	"innodb_status_output":                    true,
+	"innodb_status_output_locks":              true,
+	"innodb_strict_mode":                      true,
+	"innodb_table_locks":                      true,
+	"innodb_undo_log_encrypt":                 true,
+	"innodb_undo_log_truncate":                true,
+	"local_infile":                            true,
+	"log_bin_trust_function_creators":         true,
+	"log_queries_not_using_indexes":           true,
+	"log_replica_updates":                     true,
+	"log_slave_updates":                       true,
+	"log_slow_admin_statements":               true,
+	"log_slow_replica_statements":             true,
+	"log_slow_slave_statements":               true,
+	"low_priority_updates":                    true,
+	"offline_mode":                            true,
+	"partial_revokes":                         true,
+	"performance_schema":                      true,
+	"read_only":                               true,
+	"relay_log_purge":                         true,
+	"replica_preserve_commit_order":           true,
+	"require_secure_transport":                true,
+	"rpl_semi_sync_master_enabled":            true,
+	"rpl_semi_sync_replica_enabled":           true,
+	"rpl_semi_sync_slave_enabled":             true,
+	"rpl_semi_sync_source_enabled":            true,
+	"skip_name_resolve":                       true,
+	"skip_networking":                         true,
+	"slave_preserve_commit_order":             true,
+	"slow_query_log":                          true,
+	"sql_auto_is_null":                        true,
+	"sql_require_primary_key":                 true,
+	"super_read_only":                         true,
+	"unique_checks":                           true,
+}
+
+//枚举类型参数的合法值,参数值也可以是合法值的下标
+var enumVariables = map[string][]string{
+	"binlog_format":                    {"ROW", "STATEMENT", "MIXED"},
+	"binlog_row_image":                 {"FULL", "MINIMAL", "NOBLOB"},
+	"transaction_isolation":            {"READ-UNCOMMITTED", "READ-COMMITTED", "REPEATABLE-READ", "SERIALIZABLE"},
+	"tx_isolation":                     {"READ-UNCOMMITTED", "READ-COMMITTED", "REPEATABLE-READ", "SERIALIZABLE"},
+	"gtid_mode":                        {"OFF", "OFF_PERMISSIVE", "ON_PERMISSIVE", "ON"},
+	"enforce_gtid_consistency":         {"OFF", "ON", "WARN"},
+	"event_scheduler":                  {"ON", "OFF", "DISABLED"},
+	"slave_exec_mode":                  {"STRICT", "IDEMPOTENT"},
+	"replica_exec_mode":                {"STRICT", "IDEMPOTENT"},
+	"slave_parallel_type":              {"DATABASE", "LOGICAL_CLOCK"},
+	"replica_parallel_type":            {"DATABASE", "LOGICAL_CLOCK"},
+	"log_timestamps":                   {"UTC", "SYSTEM"},
+	"innodb_default_row_format":        {"REDUNDANT", "COMPACT", "DYNAMIC"},
+	"internal_tmp_disk_storage_engine": {"MYISAM", "INNODB"},
+	"default_storage_engine":           {"INNODB", "MYISAM", "MEMORY", "CSV", "ARCHIVE", "BLACKHOLE", "MRG_MYISAM", "FEDERATED"},
+	"rpl_semi_sync_master_wait_point":  {"AFTER_SYNC", "AFTER_COMMIT"},
+	"rpl_semi_sync_source_wait_point":  {"AFTER_SYNC", "AFTER_COMMIT"},
+	"transaction_write_set_extraction": {"OFF", "MD5", "XXHASH64"},
+	"session_track_transaction_info":   {"OFF", "STATE", "CHARACTERISTICS"},
+	"session_track_gtids":              {"OFF", "OWN_GTID", "ALL_GTIDS"},
+	"ssl_fips_mode":                    {"OFF", "ON", "STRICT"},
+	"query_cache_type":                 {"OFF", "ON", "DEMAND"},
+	"delay_key_write":                  {"OFF", "ON", "ALL"},
+	"innodb_doublewrite":               {"ON", "OFF", "DETECT_AND_RECOVER", "DETECT_ONLY"},
+}
+
+//参数的元数据
+type VariableInfo struct {
+	Name    string
+	Value   string //当前的全局值,格式与SHOW GLOBAL VARIABLES一致
+	Type    string //VariableTypeBool等,布尔和枚举类型来自内置目录,其余根据当前值推断
+	Dynamic bool   //是否可以动态修改
+	Min     string //数值类型参数的取值范围,来自8.0的performance_schema.variables_info,为空表示不检查
+	Max     string
+	Enum    []string //枚举类型参数的合法值
+}
+
+//参数修改选项
+type SetVariableOptions struct {
+	Scope      string //修改方式,默认为SetGlobal
+	Mycnf      string //将修改写入的my.cnf路径,为空时不写入,路径为执行程序的主机上的路径,通常来自MySQLInstance.Mycnf
+	MycnfGroup string //写入my.cnf的选项组,默认为mysqld
+}
+
+func mergeSetVariableOptions(opts []SetVariableOptions) *SetVariableOptions {
+	o := SetVariableOptions{}
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.Scope == "" {
+		o.Scope = SetGlobal
+	}
+	o.Scope = strings.ToUpper(o.Scope)
+	if o.MycnfGroup == "" {
+		o.MycnfGroup = "mysqld"
+	}
+	return &o
+}
+
+//根据内置目录和当前值推断参数类型,不在目录中的非数值参数为字符串类型,由服务端校验
+func inferVariableType(name, value string) string {
+	if _, ok := enumVariables[name]; ok {
+		return VariableTypeEnum
+	}
+	if boolVariables[name] {
+		return VariableTypeBool
+	}
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return VariableTypeInt
+	}
+	if _, err := strconv.ParseUint(value, 10, 64); err == nil {
+		return VariableTypeInt
+	}
+	if numericValuePattern.MatchString(value) {
+		return VariableTypeFloat
+	}
+	return VariableTypeString
+}
+
+//查看参数的元数据,参数不存在或者只有会话级别时报错
+func (d *DBHandler) GetVariableInfo(name string) (*VariableInfo, error) {
+	return d.GetVariableInfoContext(context.Background(), name)
+}
+
+//同GetVariableInfo,ctx用于超时和取消控制
+func (d *DBHandler) GetVariableInfoContext(ctx context.Context, name string) (*VariableInfo, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	if err := checkVariableName(name); err != nil {
+		return nil, err
+	}
+	name = strings.ToLower(name)
+	//LIKE中的_为通配符,需要精确匹配参数名
+	rows, err := d.conn.QueryContext(ctx, "SHOW GLOBAL VARIABLES LIKE "+quoteLiteral(name))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var info *VariableInfo
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(k, name) {
+			info = &VariableInfo{Name: name, Value: v}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, errors.New(fmt.Sprintf("参数%s不存在或者不是全局参数", name))
+	}
+	info.Type = inferVariableType(name, info.Value)
+	info.Dynamic = !staticVariables[name]
+	info.Enum = enumVariables[name]
+	version, err := d.GetVersionContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if versionAtLeast(version, persistVariableVersion) && (info.Type == VariableTypeInt || info.Type == VariableTypeFloat) {
+		var min, max sql.NullString
+		getRangeSQL := "select min_value,max_value from performance_schema.variables_info where variable_name=?"
+		//performance_schema关闭时没有取值范围,不影响修改
+		if err := d.conn.QueryRowContext(ctx, getRangeSQL, name).Scan(&min, &max); err == nil && !(min.String == "0" && max.String == "0") {
+			info.Min, info.Max = min.String, max.String
+		}
+	}
+	return info, nil
+}
+
+//校验参数值的类型和取值范围
+func (info *VariableInfo) Validate(value string) error {
+	if strings.EqualFold(value, "DEFAULT") {
+		return nil
+	}
+	switch info.Type {
+	case VariableTypeBool:
+		switch strings.ToUpper(value) {
+		case "ON", "OFF", "TRUE", "FALSE", "1", "0":
+			return nil
+		}
+		return errors.New(fmt.Sprintf("参数%s为布尔类型,不能设置为%q", info.Name, value))
+	case VariableTypeEnum:
+		for _, e := range info.Enum {
+			if strings.EqualFold(e, value) {
+				return nil
+			}
+		}
+		if i, err := strconv.Atoi(value); err == nil && i >= 0 && i < len(info.Enum) {
+			return nil
+		}
+		return errors.New(fmt.Sprintf("参数%s的值必须为%s之一,不能设置为%q", info.Name, strings.Join(info.Enum, ","), value))
+	case VariableTypeInt, VariableTypeFloat:
+		if info.Type == VariableTypeInt && !isIntegerText(value) || !numericValuePattern.MatchString(value) {
+			return errors.New(fmt.Sprintf("参数%s为%s类型,不能设置为%q", info.Name, info.Type, value))
+		}
+		v, _ := strconv.ParseFloat(value, 64)
+		if min, err := strconv.ParseFloat(info.Min, 64); err == nil && v < min {
+			return errors.New(fmt.Sprintf("参数%s的值%s小于最小值%s", info.Name, value, info.Min))
+		}
+		if max, err := strconv.ParseFloat(info.Max, 64); err == nil && v > max {
+			return errors.New(fmt.Sprintf("参数%s的值%s大于最大值%s", info.Name, value, info.Max))
+		}
+	}
+	return nil
+}
+
+func isIntegerText(value string) bool {
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return true
+	}
+	_, err := strconv.ParseUint(value, 10, 64)
+	return err == nil
+}
+
+//修改数据库参数,修改前检查参数是否存在、是否可以动态修改以及参数值的类型
+//opts可以指定PERSIST、PERSIST_ONLY,以及将修改写入my.cnf使重启后仍然生效
+func (d *DBHandler) SetVariable(varName, varValue string, opts ...SetVariableOptions) error {
+	return d.SetVariableContext(context.Background(), varName, varValue, opts...)
+}
+
+//同SetVariable,ctx用于超时和取消控制
+func (d *DBHandler) SetVariableContext(ctx context.Context, varName, varValue string, opts ...SetVariableOptions) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	o := mergeSetVariableOptions(opts)
+	info, err := d.GetVariableInfoContext(ctx, varName)
+	if err != nil {
+		return err
+	}
+	if err := info.Validate(varValue); err != nil {
+		return err
+	}
+	switch o.Scope {
+	case SetGlobal, SetPersist:
+		if !info.Dynamic {
+			return staticVariableError(info.Name)
+		}
+	case SetPersistOnly:
+	case SetMycnfOnly:
+		if o.Mycnf == "" {
+			return errors.New(SetMycnfOnly + "需要指定my.cnf路径")
+		}
+	default:
+		return errors.New("不支持的参数修改方式:" + o.Scope)
+	}
+	if o.Scope == SetPersist || o.Scope == SetPersistOnly {
+		version, err := d.GetVersionContext(ctx)
+		if err != nil {
+			return err
+		}
+		if !versionAtLeast(version, persistVariableVersion) {
+			return errors.New(fmt.Sprintf("当前版本%d.%d.%d不支持SET %s", version[0], version[1], version[2], o.Scope))
+		}
+	}
+	//my.cnf的检查需要在修改实例之前完成,避免实例已经修改但返回错误
+	if o.Mycnf != "" {
+		if strings.EqualFold(varValue, "DEFAULT") {
+			return errors.New("DEFAULT不能写入my.cnf")
+		}
+		if finfo, err := os.Stat(o.Mycnf); err != nil {
+			return err
+		} else if !finfo.Mode().IsRegular() {
+			return errors.New(o.Mycnf + "不是普通文件")
+		}
+	}
+	if o.Scope != SetMycnfOnly {
+		if _, err := d.conn.ExecContext(ctx, buildSetVariableSQL(o.Scope, info.Name, varValue)); err != nil {
+			//目录中没有列出的静态参数由服务端报错1238(ER_INCORRECT_GLOBAL_LOCAL_VAR),给出相同的提示
+			if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1238 {
+				return staticVariableError(info.Name)
+			}
+			return err
+		}
+	}
+	if o.Mycnf != "" {
+		if err := setMycnfOption(o.Mycnf, o.MycnfGroup, info.Name, varValue); err != nil {
+			return errors.Wrap(err, "参数已经在实例上修改,但写入my.cnf失败")
+		}
+	}
+	return nil
+}
+
+func staticVariableError(name string) error {
+	return errors.New(fmt.Sprintf("参数%s不能动态修改,请使用%s或者%s并重启实例", name, SetPersistOnly, SetMycnfOnly))
+}
+
+func buildSetVariableSQL(scope, name, value string) string {
+	return fmt.Sprintf("SET %s %s = %s", scope, name, quoteVariableValue(value))
+}
+
+//将选项写入my.cnf的指定选项组,已经存在的选项(包括-和_的写法以及带loose-前缀的)被替换,否则追加到选项组的末尾
+//选项组不存在时在文件末尾新建,只修改path本身,不处理!include的文件
+func setMycnfOption(path, group, name, value string) error {
+	//my.cnf为符号链接时修改链接指向的文件,避免重命名时把链接替换成普通文件
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	finfo, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	text := updateMycnfOption(string(data), group, name, value)
+	return replaceFile(path, []byte(text), finfo)
+}
+
+//先写入同一目录下的临时文件并fsync,再重命名覆盖原文件,避免写入过程中崩溃或者磁盘满导致原文件被截断
+//新文件保持原文件的权限和属主
+func replaceFile(path string, data []byte, finfo os.FileInfo) (err error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if _, err = f.Write(data); err != nil {
+		return err
+	}
+	if err = f.Chmod(finfo.Mode().Perm()); err != nil {
+		return err
+	}
+	if err = chownLike(f, finfo); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	//同步目录,保证重命名在崩溃后仍然有效
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+//修改my.cnf格式的文本,返回修改后的文本
+func updateMycnfOption(text, group, name, value string) string {
+	var (
+		lines       []string
+		newLine     = name + " = " + formatMycnfValue(value)
+		inGroup     bool
+		groupFound  bool
+		replaced    bool
+		insertAfter = -1 //选项组中最后一个非空行的位置
+	)
+	normalize := func(key string) string {
+		key = strings.Replace(strings.ToLower(strings.TrimSpace(key)), "-", "_", -1)
+		return strings.TrimPrefix(key, "loose_")
+	}
+	//不使用bufio.Scanner,超过64KB的行会使扫描提前结束,从而把截断的内容写回my.cnf
+	var rawLines []string
+	if text != "" {
+		rawLines = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	}
+	for _, line := range rawLines {
+		line = strings.TrimSuffix(line, "\r")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "["):
+			end := strings.Index(trimmed, "]")
+			inGroup = end > 0 && strings.EqualFold(strings.TrimSpace(trimmed[1:end]), group)
+			if inGroup {
+				groupFound = true
+				insertAfter = len(lines)
+			}
+		case inGroup && trimmed != "" && trimmed[0] != '#' && trimmed[0] != ';' && trimmed[0] != '!':
+			key := trimmed
+			if i := strings.Index(trimmed, "="); i >= 0 {
+				key = trimmed[:i]
+			}
+			insertAfter = len(lines)
+			if normalize(key) == normalize(name) {
+				//同一个选项出现多次时以最后一次为准,全部替换成新值,保留loose-前缀避免插件未加载时无法启动
+				line = newLine
+				if lower := strings.ToLower(strings.TrimSpace(key)); strings.HasPrefix(lower, "loose-") || strings.HasPrefix(lower, "loose_") {
+					line = strings.TrimSpace(key)[:len("loose-")] + newLine
+				}
+				replaced = true
+			}
+		}
+		lines = append(lines, line)
+	}
+	switch {
+	case replaced:
+	case groupFound:
+		lines = append(lines[:insertAfter+1], append([]string{newLine}, lines[insertAfter+1:]...)...)
+	default:
+		if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) != "" {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "["+group+"]", newLine)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+//包含空白、#或者引号的值需要加双引号
+func formatMycnfValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t#;'\"\\") {
+		return value
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInferVariableType(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"read_only", "OFF", VariableTypeBool},
+		{"query_cache_type", "OFF", VariableTypeEnum},
+		{"transaction_write_set_extraction", "OFF", VariableTypeEnum},
+		{"some_plugin_option", "ON", VariableTypeString},
+		{"max_connections", "151", VariableTypeInt},
+		{"max_binlog_cache_size", "18446744073709551615", VariableTypeInt},
+		{"long_query_time", "10.000000", VariableTypeFloat},
+		{"gtid_mode", "OFF", VariableTypeEnum},
+		{"sql_mode", "STRICT_TRANS_TABLES", VariableTypeString},
+	}
+	for _, tt := range tests {
+		if got := inferVariableType(tt.name, tt.value); got != tt.want {
+			t.Errorf("inferVariableType(%s,%s)=%s,want %s", tt.name, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestVariableInfo_Validate(t *testing.T) {
+	tests := []struct {
+		info  VariableInfo
+		value string
+		ok    bool
+	}{
+		{VariableInfo{Name: "read_only", Type: VariableTypeBool}, "on", true},
+		{VariableInfo{Name: "read_only", Type: VariableTypeBool}, "1", true},
+		{VariableInfo{Name: "read_only", Type: VariableTypeBool}, "yes", false},
+		{VariableInfo{Name: "ssl_fips_mode", Type: VariableTypeEnum, Enum: enumVariables["ssl_fips_mode"]}, "STRICT", true},
+		{VariableInfo{Name: "query_cache_type", Type: VariableTypeEnum, Enum: enumVariables["query_cache_type"]}, "2", true},
+		{VariableInfo{Name: "query_cache_type", Type: VariableTypeEnum, Enum: enumVariables["query_cache_type"]}, "3", false},
+		{VariableInfo{Name: "some_plugin_option", Type: VariableTypeString}, "FORCE", true},
+		{VariableInfo{Name: "max_connections", Type: VariableTypeInt, Min: "1", Max: "100000"}, "500", true},
+		{VariableInfo{Name: "max_connections", Type: VariableTypeInt, Min: "1", Max: "100000"}, "0", false},
+		{VariableInfo{Name: "max_connections", Type: VariableTypeInt, Min: "1", Max: "100000"}, "200000", false},
+		{VariableInfo{Name: "max_connections", Type: VariableTypeInt}, "1.5", false},
+		{VariableInfo{Name: "max_connections", Type: VariableTypeInt}, "1G", false},
+		{VariableInfo{Name: "max_connections", Type: VariableTypeInt}, "DEFAULT", true},
+		{VariableInfo{Name: "long_query_time", Type: VariableTypeFloat}, "0.5", true},
+		{VariableInfo{Name: "binlog_format", Type: VariableTypeEnum, Enum: enumVariables["binlog_format"]}, "row", true},
+		{VariableInfo{Name: "binlog_format", Type: VariableTypeEnum, Enum: enumVariables["binlog_format"]}, "rows", false},
+		{VariableInfo{Name: "sql_mode", Type: VariableTypeString}, "", true},
+	}
+	for _, tt := range tests {
+		if err := tt.info.Validate(tt.value); (err == nil) != tt.ok {
+			t.Errorf("Validate(%s=%q) error:%v,want ok=%v", tt.info.Name, tt.value, err, tt.ok)
+		}
+	}
+}
+
+func TestBuildSetVariableSQL(t *testing.T) {
+	if got := buildSetVariableSQL(SetGlobal, "read_only", "on"); got != "SET GLOBAL read_only = ON" {
+		t.Errorf("unexpected sql:%s", got)
+	}
+	if got := buildSetVariableSQL(SetPersistOnly, "sql_mode", "STRICT_TRANS_TABLES"); got != "SET PERSIST_ONLY sql_mode = 'STRICT_TRANS_TABLES'" {
+		t.Errorf("unexpected sql:%s", got)
+	}
+}
+
+func TestUpdateMycnfOption(t *testing.T) {
+	text := "[client]\nport = 3306\n\n[mysqld]\nport = 3306\nmax-connections = 100\n# comment\n\n[mysqldump]\nquick\n"
+	tests := []struct {
+		group string
+		name  string
+		value string
+		want  string
+	}{
+		{"mysqld", "max_connections", "500",
+			"[client]\nport = 3306\n\n[mysqld]\nport = 3306\nmax_connections = 500\n# comment\n\n[mysqldump]\nquick\n"},
+		{"mysqld", "read_only", "ON",
+			"[client]\nport = 3306\n\n[mysqld]\nport = 3306\nmax-connections = 100\nread_only = ON\n# comment\n\n[mysqldump]\nquick\n"},
+		{"mysqld_safe", "log_error", "/var/log/my sql.err",
+			text + "\n[mysqld_safe]\nlog_error = \"/var/log/my sql.err\"\n"},
+	}
+	for _, tt := range tests {
+		if got := updateMycnfOption(text, tt.group, tt.name, tt.value); got != tt.want {
+			t.Errorf("updateMycnfOption(%s,%s)=\n%s\nwant\n%s", tt.group, tt.name, got, tt.want)
+		}
+	}
+	//loose-前缀的选项也被替换,并保留前缀
+	if got := updateMycnfOption("[mysqld]\nloose-rpl_semi_sync_master_enabled = 0\n", "mysqld", "rpl_semi_sync_master_enabled", "ON"); got != "[mysqld]\nloose-rpl_semi_sync_master_enabled = ON\n" {
+		t.Errorf("unexpected loose option:%s", got)
+	}
+	//超长的行不能导致后面的内容丢失
+	long := "# " + strings.Repeat("x", 100<<10)
+	text = "[mysqld]\n" + long + "\nport = 3306\n"
+	if got := updateMycnfOption(text, "mysqld", "max_connections", "1000"); got != "[mysqld]\n"+long+"\nport = 3306\nmax_connections = 1000\n" {
+		t.Errorf("long line truncated the file,got %d bytes", len(got))
+	}
+}
+
+func TestSetMycnfOption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "my.cnf")
+	if err := ioutil.WriteFile(path, []byte("[mysqld]\nport=3306\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := setMycnfOption(path, "mysqld", "max_connections", "1000"); err != nil {
+		t.Fatal(err)
+	}
+	options := make(map[string]string)
+	if err := readOptionFile(path, []string{"mysqld"}, options, 0); err != nil {
+		t.Fatal(err)
+	}
+	if options["max_connections"] != "1000" || options["port"] != "3306" {
+		t.Errorf("unexpected options:%v", options)
+	}
+	//通过临时文件替换,保持原文件的权限,不残留临时文件
+	if finfo, err := os.Stat(path); err != nil || finfo.Mode().Perm() != 0640 {
+		t.Errorf("unexpected file mode:%v,%v", finfo, err)
+	}
+	if files, err := ioutil.ReadDir(filepath.Dir(path)); err != nil || len(files) != 1 {
+		t.Errorf("unexpected files in dir:%v,%v", files, err)
+	}
+}